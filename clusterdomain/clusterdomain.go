@@ -0,0 +1,88 @@
+package clusterdomain
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Default is the cluster domain used if none is set.
+const Default = "cluster.local"
+
+// ResolvConfPath is the resolver configuration that Detect examines in a POD.
+const ResolvConfPath = "/etc/resolv.conf"
+
+var (
+	domain  = Default
+	aliases []string
+	mutex   sync.RWMutex
+)
+
+// Set sets the cluster domain and its aliases.
+func Set(clusterDomain string, clusterDomainAliases []string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	domain = clusterDomain
+	aliases = clusterDomainAliases
+}
+
+// Get returns the cluster domain.
+func Get() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return domain
+}
+
+// Aliases returns the alias domains the cluster is also known by.
+func Aliases() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return aliases
+}
+
+// Normalize returns a domain trimmed of whitespace and a trailing dot and lowercased.
+func Normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// ParseAliases returns the domains in a comma-separated list, normalized, omitting empty entries.
+func ParseAliases(list string) []string {
+	var ret []string
+	for _, alias := range strings.Split(list, ",") {
+		alias = Normalize(alias)
+		if alias != "" {
+			ret = append(ret, alias)
+		}
+	}
+	return ret
+}
+
+// Detect returns the cluster domain from the search path of a POD's resolver configuration, which
+// Kubernetes sets to "<namespace>.svc.<domain> svc.<domain> <domain>".
+func Detect(resolvConfPath string) (string, error) {
+	file, err := os.Open(resolvConfPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "search" {
+			continue
+		}
+		for _, search := range fields[1:] {
+			search = strings.TrimSuffix(strings.ToLower(search), ".")
+			if strings.HasPrefix(search, "svc.") && len(search) > len("svc.") {
+				return strings.TrimPrefix(search, "svc."), nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no svc.<domain> entry in search path of " + resolvConfPath)
+}
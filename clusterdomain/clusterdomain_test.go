@@ -0,0 +1,102 @@
+package clusterdomain_test
+
+import (
+	"github.com/proofpoint/kapprover/clusterdomain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	assert.Equal(t, clusterdomain.Default, clusterdomain.Get(), "default domain")
+	assert.Empty(t, clusterdomain.Aliases(), "default aliases")
+
+	clusterdomain.Set("example.com", []string{"old.example.com"})
+	defer clusterdomain.Set(clusterdomain.Default, nil)
+	assert.Equal(t, "example.com", clusterdomain.Get(), "domain")
+	assert.Equal(t, []string{"old.example.com"}, clusterdomain.Aliases(), "aliases")
+}
+
+func TestNormalize(t *testing.T) {
+	for domain, expectDomain := range map[string]string{
+		"cluster.local":    "cluster.local",
+		" Cluster.Local. ": "cluster.local",
+		"example.com.":     "example.com",
+		" ":                "",
+		".":                "",
+	} {
+		assert.Equal(t, expectDomain, clusterdomain.Normalize(domain), domain)
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	for list, expectAliases := range map[string][]string{
+		"":                              nil,
+		"old.example.com":               {"old.example.com"},
+		"a.example.com, B.Example.com.": {"a.example.com", "b.example.com"},
+		"a.example.com,,b.example.com":  {"a.example.com", "b.example.com"},
+		" , ":                           nil,
+	} {
+		assert.Equal(t, expectAliases, clusterdomain.ParseAliases(list), list)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clusterdomain")
+	require.NoError(t, err, "TempDir")
+	defer func() {
+		assert.NoError(t, os.RemoveAll(dir))
+	}()
+
+	for _, testcase := range []struct {
+		name         string
+		resolvConf   string
+		expectDomain string
+		expectErr    string
+	}{
+		{
+			name:         "Pod",
+			resolvConf:   "nameserver 10.96.0.10\nsearch kube-system.svc.cluster.local svc.cluster.local cluster.local\noptions ndots:5\n",
+			expectDomain: "cluster.local",
+		},
+		{
+			name:         "Custom",
+			resolvConf:   "search kube-system.svc.k8s.example.com svc.k8s.example.com k8s.example.com example.com\nnameserver 10.96.0.10\n",
+			expectDomain: "k8s.example.com",
+		},
+		{
+			name:         "TrailingDot",
+			resolvConf:   "search kube-system.svc.Cluster.Local. svc.Cluster.Local. cluster.local.\n",
+			expectDomain: "cluster.local",
+		},
+		{
+			name:       "NotInPod",
+			resolvConf: "nameserver 192.0.2.53\nsearch example.com\n",
+			expectErr:  "no svc.<domain> entry in search path of " + filepath.Join(dir, "NotInPod"),
+		},
+		{
+			name:       "EmptyDomain",
+			resolvConf: "search svc.\n",
+			expectErr:  "no svc.<domain> entry in search path of " + filepath.Join(dir, "EmptyDomain"),
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			path := filepath.Join(dir, testcase.name)
+			require.NoError(t, ioutil.WriteFile(path, []byte(testcase.resolvConf), 0600))
+
+			domain, err := clusterdomain.Detect(path)
+			assert.Equal(t, testcase.expectDomain, domain, "Domain")
+			if testcase.expectErr == "" {
+				assert.NoError(t, err, "Error")
+			} else {
+				assert.EqualError(t, err, testcase.expectErr, "Error")
+			}
+		})
+	}
+
+	_, err = clusterdomain.Detect(filepath.Join(dir, "missing"))
+	assert.Error(t, err, "missing file")
+}
@@ -2,27 +2,44 @@ package main
 
 import (
 	"flag"
+	"github.com/proofpoint/kapprover/clusterdomain"
 	"github.com/proofpoint/kapprover/inspectors"
 	"github.com/proofpoint/kapprover/kapprover"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"time"
 
+	_ "github.com/proofpoint/kapprover/inspectors/altnames"
 	_ "github.com/proofpoint/kapprover/inspectors/altnamesforpod"
+	_ "github.com/proofpoint/kapprover/inspectors/bootstraptoken"
+	_ "github.com/proofpoint/kapprover/inspectors/exec"
+	_ "github.com/proofpoint/kapprover/inspectors/extensions"
 	_ "github.com/proofpoint/kapprover/inspectors/group"
 	_ "github.com/proofpoint/kapprover/inspectors/keyusage"
+	_ "github.com/proofpoint/kapprover/inspectors/kubeletclient"
+	_ "github.com/proofpoint/kapprover/inspectors/kubeletserving"
 	_ "github.com/proofpoint/kapprover/inspectors/minrsakeysize"
 	_ "github.com/proofpoint/kapprover/inspectors/noextensions"
+	_ "github.com/proofpoint/kapprover/inspectors/publickey"
 	_ "github.com/proofpoint/kapprover/inspectors/signaturealgorithm"
+	_ "github.com/proofpoint/kapprover/inspectors/strictcsr"
+	_ "github.com/proofpoint/kapprover/inspectors/subject"
 	_ "github.com/proofpoint/kapprover/inspectors/subjectispodforuser"
+	_ "github.com/proofpoint/kapprover/inspectors/subjectisserviceforuser"
 	_ "github.com/proofpoint/kapprover/inspectors/username"
+	_ "github.com/proofpoint/kapprover/inspectors/weakkey"
+	_ "github.com/proofpoint/kapprover/inspectors/webhook"
 )
 
 var (
 	kubeconfigPath = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	deleteAfter    = flag.Duration("delete-after", time.Minute, "duration after which to delete filtered requests")
+	clusterDomain  = flag.String("cluster-domain", clusterdomain.Default, "DNS domain of the cluster, for inspectors not configured with one")
+	detectDomain   = flag.Bool("detect-cluster-domain", false, "detect the cluster domain from the search path in "+clusterdomain.ResolvConfPath)
+	domainAliases  = flag.String("cluster-domain-aliases", "", "comma-separated other DNS domains the cluster is known by")
 	filters        inspectors.Inspectors
 	deniers        inspectors.Inspectors
 	warners        inspectors.Inspectors
@@ -38,6 +55,22 @@ func init() {
 func main() {
 	flag.Parse()
 
+	domain := clusterdomain.Normalize(*clusterDomain)
+	if domain == "" && !*detectDomain {
+		log.Errorf("Invalid cluster domain %q", *clusterDomain)
+		return
+	}
+	if *detectDomain {
+		var err error
+		domain, err = clusterdomain.Detect(clusterdomain.ResolvConfPath)
+		if err != nil {
+			log.Errorf("Could not detect cluster domain: %s", err)
+			return
+		}
+		log.Infof("Detected cluster domain %q", domain)
+	}
+	clusterdomain.Set(domain, clusterdomain.ParseAliases(*domainAliases))
+
 	// Create a Kubernetes client.
 	client, err := newClient(*kubeconfigPath)
 	if err != nil {
@@ -49,7 +82,17 @@ func main() {
 	kapprover.HandleRequests(filters, deniers, warners, *deleteAfter, client)
 }
 
-func newClient(kubeconfigPath string) (*kubernetes.Clientset, error) {
+// clientset is a Kubernetes client that can also read resources for which there is no typed client.
+type clientset struct {
+	*kubernetes.Clientset
+	dynamic dynamic.Interface
+}
+
+func (c *clientset) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
+
+func newClient(kubeconfigPath string) (*clientset, error) {
 	var config *rest.Config
 	var err error
 	if kubeconfigPath != "" {
@@ -66,5 +109,13 @@ func newClient(kubeconfigPath string) (*kubernetes.Clientset, error) {
 		}
 	}
 
-	return kubernetes.NewForConfig(config)
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &clientset{Clientset: client, dynamic: dynamicClient}, nil
 }
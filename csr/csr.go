@@ -1,14 +1,79 @@
 package csr
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"strconv"
 	"strings"
 )
 
+// Extract parses the PEM-encoded certificate request in data and verifies its self-signature,
+// the requester's proof of possession of the private key. It returns a message to take
+// adverse action if the request is unparseable or its signature cannot be verified.
 func Extract(data []byte) (certificateRequest *x509.CertificateRequest, rejectMessage string) {
+	der, rejectMessage := decode(data)
+	if rejectMessage != "" {
+		return nil, rejectMessage
+	}
+
+	certificateRequest, rejectMessage = parse(der)
+	if rejectMessage != "" {
+		return nil, rejectMessage
+	}
+
+	return verify(certificateRequest)
+}
+
+// ExtractPublicKey returns the public key of the PEM-encoded certificate request in data without
+// parsing the rest of the request or verifying its signature, so that a key too weak to verify a
+// signature with can still be inspected. An ECDSA point is returned even if it is not on the
+// curve. It returns a message to take adverse action if the public key is unparseable.
+func ExtractPublicKey(data []byte) (publicKey interface{}, rejectMessage string) {
+	der, rejectMessage := decode(data)
+	if rejectMessage != "" {
+		return nil, rejectMessage
+	}
+
+	var certificateRequest struct {
+		Info struct {
+			Version   int
+			Subject   asn1.RawValue
+			PublicKey struct {
+				Raw       asn1.RawContent
+				Algorithm pkix.AlgorithmIdentifier
+				PublicKey asn1.BitString
+			}
+		}
+	}
+	if _, err := asn1.Unmarshal(der, &certificateRequest); err != nil {
+		return nil, fmt.Sprintf("Request had invalid certificate request: %s", err)
+	}
+	publicKeyInfo := certificateRequest.Info.PublicKey
+
+	if publicKeyInfo.Algorithm.Algorithm.Equal(oidPublicKeyEcdsa) {
+		publicKey, err := parseEcdsaPublicKey(publicKeyInfo.Algorithm.Parameters.FullBytes, publicKeyInfo.PublicKey.RightAlign())
+		if err != nil {
+			return nil, fmt.Sprintf("Request had invalid public key: %s", err)
+		}
+		return publicKey, ""
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(publicKeyInfo.Raw)
+	if err != nil {
+		return nil, fmt.Sprintf("Request had invalid public key: %s", err)
+	}
+	return publicKey, ""
+}
+
+func decode(data []byte) ([]byte, string) {
 	certificateRequestBytes, rest := pem.Decode(data)
 	if certificateRequestBytes == nil {
 		return nil, "Request did not have a parseable PEM object"
@@ -19,37 +84,105 @@ func Extract(data []byte) (certificateRequest *x509.CertificateRequest, rejectMe
 		return nil, "Request had more than one PEM object"
 	}
 
-	certificateRequest, err := x509.ParseCertificateRequest(certificateRequestBytes.Bytes)
+	return certificateRequestBytes.Bytes, ""
+}
+
+var (
+	oidPublicKeyEcdsa = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	namedCurves = map[string]elliptic.Curve{
+		"1.2.840.10045.3.1.7": elliptic.P256(),
+		"1.3.132.0.34":        elliptic.P384(),
+		"1.3.132.0.35":        elliptic.P521(),
+		"1.3.132.0.33":        elliptic.P224(),
+	}
+)
+
+// parseEcdsaPublicKey parses an uncompressed ECDSA point on a named curve without checking that
+// it is on the curve, which x509.ParsePKIXPublicKey refuses to return.
+func parseEcdsaPublicKey(parameters []byte, point []byte) (*ecdsa.PublicKey, error) {
+	var curveOid asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(parameters, &curveOid); err != nil || len(rest) != 0 {
+		return nil, errors.New("ECDSA parameters are not a named curve")
+	}
+	curve, ok := namedCurves[curveOid.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported elliptic curve %s", curveOid)
+	}
+
+	byteLen := (curve.Params().BitSize + 7) / 8
+	if len(point) != 1+2*byteLen || point[0] != 4 {
+		return nil, errors.New("ECDSA point is not in uncompressed form")
+	}
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(point[1 : 1+byteLen]),
+		Y:     new(big.Int).SetBytes(point[1+byteLen:]),
+	}, nil
+}
+
+func parse(der []byte) (*x509.CertificateRequest, string) {
+	certificateRequest, err := x509.ParseCertificateRequest(der)
 	if err != nil {
 		return nil, fmt.Sprintf("Request had invalid certificate request: %s", err)
 	}
-
 	return certificateRequest, ""
 }
 
-func GetPodIpAndNamespace(clusterDomain string, certificateRequest *x509.CertificateRequest) (podIp, namespace, message string) {
-	if len(certificateRequest.Subject.Names) > 1 {
-		return "", "", "Subject has more than one name component"
-	}
+// publicKeyAlgorithms maps signature algorithms to the type of public key that verifies them.
+var publicKeyAlgorithms = map[x509.SignatureAlgorithm]x509.PublicKeyAlgorithm{
+	x509.MD5WithRSA:       x509.RSA,
+	x509.SHA1WithRSA:      x509.RSA,
+	x509.SHA256WithRSA:    x509.RSA,
+	x509.SHA384WithRSA:    x509.RSA,
+	x509.SHA512WithRSA:    x509.RSA,
+	x509.ECDSAWithSHA1:    x509.ECDSA,
+	x509.ECDSAWithSHA256:  x509.ECDSA,
+	x509.ECDSAWithSHA384:  x509.ECDSA,
+	x509.ECDSAWithSHA512:  x509.ECDSA,
+	x509.SHA256WithRSAPSS: x509.RSA,
+	x509.SHA384WithRSAPSS: x509.RSA,
+	x509.SHA512WithRSAPSS: x509.RSA,
+	x509.PureEd25519:      x509.Ed25519,
+}
 
-	if !strings.HasSuffix(certificateRequest.Subject.CommonName, ".pod."+clusterDomain) {
-		return "", "", fmt.Sprintf("Subject %q is not in the pod.%s domain", certificateRequest.Subject.CommonName, clusterDomain)
+func verify(certificateRequest *x509.CertificateRequest) (*x509.CertificateRequest, string) {
+	if publicKeyAlgorithm, ok := publicKeyAlgorithms[certificateRequest.SignatureAlgorithm]; ok && publicKeyAlgorithm != certificateRequest.PublicKeyAlgorithm {
+		return nil, fmt.Sprintf("SignatureAlgorithm %s is inconsistent with public key type %s", certificateRequest.SignatureAlgorithm, certificateRequest.PublicKeyAlgorithm)
 	}
 
-	splitName := strings.Split(strings.TrimSuffix(certificateRequest.Subject.CommonName, ".pod."+clusterDomain), ".")
-	if len(splitName) != 2 {
-		return "", "", fmt.Sprintf("Subject %q is not a POD-format name", certificateRequest.Subject.CommonName)
+	if err := certificateRequest.CheckSignature(); err != nil {
+		if _, insecure := err.(x509.InsecureAlgorithmError); insecure || err == x509.ErrUnsupportedAlgorithm {
+			if certificateRequest.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+				return nil, "Request had unsupported signature algorithm"
+			}
+			return nil, fmt.Sprintf("Request had unsupported signature algorithm %s", certificateRequest.SignatureAlgorithm)
+		}
+		return nil, fmt.Sprintf("Request had invalid signature: %s", err)
 	}
 
-	splitIp := strings.Split(splitName[0], "-")
-	if len(splitIp) != 4 {
-		return "", "", fmt.Sprintf("Subject %q is not a POD-format name", certificateRequest.Subject.CommonName)
-	}
-	for _, byteStr := range splitIp {
-		val, err := strconv.ParseUint(byteStr, 10, 8)
-		if err != nil || (val == 0 && byteStr != "0") || (byteStr[0] == '0' && val != 0) {
-			return "", "", fmt.Sprintf("Subject %q is not a POD-format name", certificateRequest.Subject.CommonName)
+	return certificateRequest, ""
+}
+
+// PodLabelToIp returns the IP address encoded in the first label of a POD DNS name, or the empty
+// string if the label is not the canonical encoding of an address. An IPv4 address is encoded by
+// replacing its dots with dashes and an IPv6 address by replacing the colons of its compressed
+// form with dashes.
+func PodLabelToIp(label string) string {
+	splitIp := strings.Split(label, "-")
+	if len(splitIp) == 4 && !strings.Contains(label, "--") {
+		for _, byteStr := range splitIp {
+			val, err := strconv.ParseUint(byteStr, 10, 8)
+			if err != nil || (val == 0 && byteStr != "0") || (byteStr[0] == '0' && val != 0) {
+				return ""
+			}
 		}
+		return strings.Join(splitIp, ".")
+	}
+
+	ip := net.ParseIP(strings.Replace(label, "-", ":", -1))
+	if ip == nil || ip.To4() != nil || strings.Replace(ip.String(), ":", "-", -1) != label {
+		return ""
 	}
-	return strings.Join(splitIp, "."), splitName[1], ""
+	return ip.String()
 }
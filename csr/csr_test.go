@@ -1,16 +1,20 @@
 package csr_test
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"github.com/proofpoint/kapprover/csr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/kubernetes"
 	"regexp"
+	"strings"
 	"testing"
 
 	_ "github.com/proofpoint/kapprover/inspectors/minrsakeysize"
@@ -85,155 +89,296 @@ func TestExtractNotCSR(t *testing.T) {
 	assert.Regexp(t, regexp.MustCompile("Request had invalid certificate request: .*"), message, "CSR extract message")
 }
 
-func TestGetPodIpAndNamespace(t *testing.T) {
+func TestExtractBadSignature(t *testing.T) {
+	certificateRequest := makeCertificateRequest(t)
+
+	raw := unmarshalCertificateRequest(t, certificateRequest)
+	raw.SignatureValue.Bytes[len(raw.SignatureValue.Bytes)-1] ^= 0xff
+	certificateRequest, err := asn1.Marshal(raw)
+	require.NoError(t, err, "Marshal the CSR")
+
+	extracted, message := csr.Extract(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}))
+	assert.Nil(t, extracted, "CSR bytes")
+	assert.Equal(t, "Request had invalid signature: crypto/rsa: verification error", message, "CSR extract message")
+}
+
+func TestExtractInconsistentPublicKey(t *testing.T) {
+	raw := unmarshalCertificateRequest(t, makeCertificateRequest(t))
+	raw.SignatureAlgorithm = pkix.AlgorithmIdentifier{
+		Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2},
+	}
+	certificateRequest, err := asn1.Marshal(raw)
+	require.NoError(t, err, "Marshal the CSR")
+
+	extracted, message := csr.Extract(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}))
+	assert.Nil(t, extracted, "CSR bytes")
+	assert.Equal(t, "SignatureAlgorithm ECDSA-SHA256 is inconsistent with public key type RSA", message, "CSR extract message")
+}
+
+func TestExtractPublicKey(t *testing.T) {
+	raw := unmarshalCertificateRequest(t, makeCertificateRequest(t))
+	raw.SignatureValue.Bytes[len(raw.SignatureValue.Bytes)-1] ^= 0xff
+	certificateRequest, err := asn1.Marshal(raw)
+	require.NoError(t, err, "Marshal the CSR")
+
+	publicKey, message := csr.ExtractPublicKey(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}))
+	assert.Empty(t, message, "CSR extract message")
+	assert.IsType(t, &rsa.PublicKey{}, publicKey, "Public key")
+
+	publicKey, message = csr.ExtractPublicKey([]byte("nothing here"))
+	assert.Nil(t, publicKey, "Public key")
+	assert.Equal(t, "Request did not have a parseable PEM object", message, "CSR extract message")
+}
+
+func TestExtractUnsupportedSignatureAlgorithm(t *testing.T) {
 	for _, testcase := range []struct {
-		name            string
-		clusterDomain   string
-		setupRequest    func(request *x509.CertificateRequest)
-		expectPodIp     string
-		expectNamespace string
-		expectMessage   string
+		name          string
+		algorithm     asn1.ObjectIdentifier
+		expectMessage string
 	}{
 		{
-			name:          "CnHasO",
-			expectMessage: "Subject has more than one name component",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.ExtraNames = []pkix.AttributeTypeAndValue{
-					{
-						Type:  []int{2, 5, 4, 10},
-						Value: "SomeOrg",
-					},
-				}
-			},
+			name:          "MD5WithRSA",
+			algorithm:     asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 4},
+			expectMessage: "Request had unsupported signature algorithm MD5-RSA",
 		},
 		{
-			name:          "CnHasTwoCN",
-			expectMessage: "Subject has more than one name component",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.ExtraNames = []pkix.AttributeTypeAndValue{
-					{
-						Type:  []int{2, 5, 4, 3},
-						Value: []string{"example.com"},
-					},
-					{
-						Type:  []int{2, 5, 4, 3},
-						Value: []string{"example.org"},
-					},
-				}
-			},
+			name:          "Unknown",
+			algorithm:     asn1.ObjectIdentifier{1, 2, 3, 4},
+			expectMessage: "Request had unsupported signature algorithm",
 		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			raw := unmarshalCertificateRequest(t, makeCertificateRequest(t))
+			raw.SignatureAlgorithm = pkix.AlgorithmIdentifier{
+				Algorithm:  testcase.algorithm,
+				Parameters: asn1.NullRawValue,
+			}
+			certificateRequest, err := asn1.Marshal(raw)
+			require.NoError(t, err, "Marshal the CSR")
+
+			extracted, message := csr.Extract(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}))
+			assert.Nil(t, extracted, "CSR bytes")
+			assert.Equal(t, testcase.expectMessage, message, "CSR extract message")
+		})
+	}
+}
+
+func TestExtractStrict(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   "example.invalid",
+			Organization: []string{"Example"},
+		},
+		DNSNames:           []string{"example.invalid"},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+	good := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}))
+
+	commonName, err := asn1.Marshal(pkix.AttributeTypeAndValue{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "a"})
+	require.NoError(t, err, "Marshal CN")
+	organization, err := asn1.Marshal(pkix.AttributeTypeAndValue{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: "b"})
+	require.NoError(t, err, "Marshal O")
+	unsortedSubject := marshalRaw(t, asn1.TagSequence, marshalRaw(t, asn1.TagSet, append(organization, commonName...)))
+
+	challengePassword, err := asn1.Marshal(struct {
+		Type  asn1.ObjectIdentifier
+		Value []string `asn1:"set"`
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}, []string{"secret"}})
+	require.NoError(t, err, "Marshal challengePassword")
+	unknownAttribute, err := asn1.Marshal(struct {
+		Type  asn1.ObjectIdentifier
+		Value []string `asn1:"set"`
+	}{asn1.ObjectIdentifier{1, 2, 3, 4}, []string{"value"}})
+	require.NoError(t, err, "Marshal unknown attribute")
+	emptyExtensionRequest, err := asn1.Marshal(struct {
+		Type  asn1.ObjectIdentifier
+		Value [][]pkix.Extension `asn1:"set"`
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}, [][]pkix.Extension{{}}})
+	require.NoError(t, err, "Marshal empty extension request")
+
+	for _, testcase := range []struct {
+		name          string
+		data          string
+		expectMessage string
+	}{
 		{
-			name:          "NotInClusterDomain",
-			expectMessage: "Subject \"172-1-2-3.somenamespace.pod.example.com\" is not in the pod.cluster.local domain",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-2-3.somenamespace.pod.example.com"
-			},
+			name: "Good",
+			data: good,
 		},
 		{
-			name:          "NotAPodDomain",
-			expectMessage: "Subject \"172-1-2-3.somenamespace.svc.cluster.local\" is not in the pod.cluster.local domain",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-2-3.somenamespace.svc.cluster.local"
-			},
+			name: "SurroundingWhitespace",
+			data: "\n\n" + good + "\n  \n",
 		},
 		{
-			name:          "ExtraDomainComponents",
-			expectMessage: "Subject \"172-1-2-3.somenamespace.extra.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-2-3.somenamespace.extra.pod.cluster.local"
-			},
+			name:          "TextBefore",
+			data:          "Here is my request\n" + good,
+			expectMessage: "Request had text before the PEM object",
 		},
 		{
-			name:          "MissingNamespace",
-			expectMessage: "Subject \"172-1-2-3.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-2-3.pod.cluster.local"
-			},
+			name:          "TextAfter",
+			data:          good + "Thanks!\n",
+			expectMessage: "Request had text after the PEM object",
 		},
 		{
-			name:          "IpTooShort",
-			expectMessage: "Subject \"172-1-2.somenamespace.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-2.somenamespace.pod.cluster.local"
-			},
+			name:          "TwoObjects",
+			data:          good + good,
+			expectMessage: "Request had more than one PEM object",
 		},
 		{
-			name:          "IpTooLong",
-			expectMessage: "Subject \"172-1-2-3-4.somenamespace.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-2-3-4.somenamespace.pod.cluster.local"
-			},
+			name:          "WrongType",
+			data:          strings.Replace(good, "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST", 2),
+			expectMessage: "Request had PEM object of type \"NEW CERTIFICATE REQUEST\"",
 		},
 		{
-			name:          "IpNumberTooLarge",
-			expectMessage: "Subject \"172-256-2-3.somenamespace.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-256-2-3.somenamespace.pod.cluster.local"
-			},
+			name:          "Headers",
+			data:          string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Headers: map[string]string{"Comment": "hi"}, Bytes: certificateRequest})),
+			expectMessage: "Request had PEM headers",
 		},
 		{
-			name:          "IpNonDigit",
-			expectMessage: "Subject \"172-1a-2-3.somenamespace.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1a-2-3.somenamespace.pod.cluster.local"
-			},
+			name: "UnsortedSet",
+			data: resignCertificateRequest(t, key, certificateRequest, func(tbs *rawTBSCertificateRequest) {
+				tbs.Subject = asn1.RawValue{FullBytes: unsortedSubject}
+			}),
+			expectMessage: "Request was not canonical DER: encoding does not round-trip",
 		},
 		{
-			name:          "IpLeadingZero",
-			expectMessage: "Subject \"172-01-2-3.somenamespace.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-01-2-3.somenamespace.pod.cluster.local"
-			},
+			name: "ChallengePassword",
+			data: resignCertificateRequest(t, key, certificateRequest, func(tbs *rawTBSCertificateRequest) {
+				tbs.RawAttributes = append([]asn1.RawValue{{FullBytes: challengePassword}}, tbs.RawAttributes...)
+			}),
+			expectMessage: "Request had unsupported attribute challengePassword",
 		},
 		{
-			name:          "IpMissingByte",
-			expectMessage: "Subject \"172--2-3.somenamespace.pod.cluster.local\" is not a POD-format name",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172--2-3.somenamespace.pod.cluster.local"
-			},
+			name: "UnknownAttribute",
+			data: resignCertificateRequest(t, key, certificateRequest, func(tbs *rawTBSCertificateRequest) {
+				tbs.RawAttributes = append([]asn1.RawValue{{FullBytes: unknownAttribute}}, tbs.RawAttributes...)
+			}),
+			expectMessage: "Request had unsupported attribute 1.2.3.4",
 		},
 		{
-			name:            "Good",
-			expectPodIp:     "172.1.0.3",
-			expectNamespace: "somenamespace",
+			name: "UnsortedAttributes",
+			data: resignCertificateRequest(t, key, certificateRequest, func(tbs *rawTBSCertificateRequest) {
+				tbs.RawAttributes = append(tbs.RawAttributes, asn1.RawValue{FullBytes: emptyExtensionRequest})
+			}),
+			expectMessage: "Request was not canonical DER: attributes are not sorted",
 		},
 		{
-			name:          "ConfiguredNotInClusterDomain",
-			clusterDomain: "example.com",
-			expectMessage: "Subject \"172-1-0-3.somenamespace.pod.cluster.local\" is not in the pod.example.com domain",
+			name: "DuplicateAttribute",
+			data: resignCertificateRequest(t, key, certificateRequest, func(tbs *rawTBSCertificateRequest) {
+				tbs.RawAttributes = append([]asn1.RawValue{{FullBytes: emptyExtensionRequest}}, tbs.RawAttributes...)
+			}),
+			expectMessage: "Request had duplicate attribute extensionRequest",
 		},
 		{
-			name:          "ConfiguredGood",
-			clusterDomain: "example.com",
-			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.example.com"
-			},
-			expectMessage:   "",
-			expectPodIp:     "172.1.0.3",
-			expectNamespace: "somenamespace",
+			name: "Resigned",
+			data: resignCertificateRequest(t, key, certificateRequest, func(tbs *rawTBSCertificateRequest) {}),
 		},
 	} {
 		t.Run(testcase.name, func(t *testing.T) {
-			clusterDomain := testcase.clusterDomain
-			if clusterDomain == "" {
-				clusterDomain = "cluster.local"
-			}
-			certificateRequestTemplate := x509.CertificateRequest{
-				Subject: pkix.Name{
-					CommonName: "172-1-0-3.somenamespace.pod.cluster.local",
-				},
+			extracted, message := csr.ExtractStrict([]byte(testcase.data))
+			assert.Equal(t, testcase.expectMessage, message, "CSR extract message")
+			if testcase.expectMessage == "" {
+				require.NotNil(t, extracted, "CSR")
+				assert.Equal(t, "example.invalid", extracted.Subject.CommonName)
+			} else {
+				assert.Nil(t, extracted, "CSR")
 			}
-			if testcase.setupRequest != nil {
-				testcase.setupRequest(&certificateRequestTemplate)
+
+			_, message = csr.Extract([]byte(testcase.data))
+			if testcase.name != "TwoObjects" {
+				assert.Empty(t, message, "non-strict CSR extract message")
 			}
-			certificateRequestTemplate.Subject.Names = make([]pkix.AttributeTypeAndValue, 0)
-			certificateRequestTemplate.Subject.Names = append(certificateRequestTemplate.Subject.Names, pkix.AttributeTypeAndValue{Type: []int{2, 5, 4, 3}, Value: certificateRequestTemplate.Subject.CommonName})
-			certificateRequestTemplate.Subject.Names = append(certificateRequestTemplate.Subject.Names, certificateRequestTemplate.Subject.ExtraNames...)
-
-			podIp, namespace, msg := csr.GetPodIpAndNamespace(clusterDomain, &certificateRequestTemplate)
-			assert.Equal(t, testcase.expectPodIp, podIp, "Namespace")
-			assert.Equal(t, testcase.expectNamespace, namespace, "Namespace")
-			assert.Equal(t, testcase.expectMessage, msg, "Message")
 		})
 	}
 }
+
+type rawTBSCertificateRequest struct {
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+// resignCertificateRequest modifies the CertificationRequestInfo of the request and signs it again.
+func resignCertificateRequest(t *testing.T, key *rsa.PrivateKey, certificateRequest []byte, modify func(tbs *rawTBSCertificateRequest)) string {
+	raw := unmarshalCertificateRequest(t, certificateRequest)
+
+	var tbs rawTBSCertificateRequest
+	_, err := asn1.Unmarshal(raw.TBSCSR.FullBytes, &tbs)
+	require.NoError(t, err, "Unmarshal the CSR info")
+	modify(&tbs)
+	tbsBytes, err := asn1.Marshal(tbs)
+	require.NoError(t, err, "Marshal the CSR info")
+
+	digest := sha256.Sum256(tbsBytes)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err, "Sign the CSR info")
+
+	raw.TBSCSR = asn1.RawValue{FullBytes: tbsBytes}
+	raw.SignatureValue = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+	certificateRequest, err = asn1.Marshal(raw)
+	require.NoError(t, err, "Marshal the CSR")
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}))
+}
+
+func marshalRaw(t *testing.T, tag int, content []byte) []byte {
+	encoded, err := asn1.Marshal(asn1.RawValue{Tag: tag, IsCompound: true, Bytes: content})
+	require.NoError(t, err, "Marshal")
+	return encoded
+}
+
+type rawCertificateRequest struct {
+	TBSCSR             asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+func makeCertificateRequest(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+	return certificateRequest
+}
+
+func unmarshalCertificateRequest(t *testing.T, certificateRequest []byte) rawCertificateRequest {
+	var raw rawCertificateRequest
+	_, err := asn1.Unmarshal(certificateRequest, &raw)
+	require.NoError(t, err, "Unmarshal the CSR")
+	return raw
+}
+
+func TestPodLabelToIp(t *testing.T) {
+	for label, expectIp := range map[string]string{
+		"172-1-0-3":              "172.1.0.3",
+		"172-1-2":                "",
+		"172-1-2-3-4":            "",
+		"172-256-2-3":            "",
+		"172-1a-2-3":             "",
+		"172-01-2-3":             "",
+		"172-1-2-":               "",
+		"fd00-10-244--3":         "fd00:10:244::3",
+		"2001-db8-1-2-3-4-5-6":   "2001:db8:1:2:3:4:5:6",
+		"172--2-3":               "172::2:3",
+		"fd00-10-244-0-0-0-0-3":  "",
+		"fd00-0010-244--3":       "",
+		"FD00-10-244--3":         "",
+		"2001-db8-1-2-3-4-5-6-7": "",
+		"--ffff-ac01-3":          "",
+	} {
+		assert.Equal(t, expectIp, csr.PodLabelToIp(label), label)
+	}
+}
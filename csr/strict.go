@@ -0,0 +1,188 @@
+package csr
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	oidAttributeExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+
+	attributeNames = map[string]string{
+		"1.2.840.113549.1.9.2":  "unstructuredName",
+		"1.2.840.113549.1.9.7":  "challengePassword",
+		"1.2.840.113549.1.9.14": "extensionRequest",
+	}
+
+	errUnsortedAttributes = errors.New("attributes are not sorted")
+)
+
+// ExtractStrict is like Extract, but additionally requires the request to be exactly one
+// "CERTIFICATE REQUEST" PEM block without headers and surrounded only by whitespace, to be
+// encoded in canonical DER, and to have no attributes other than an extension request.
+func ExtractStrict(data []byte) (certificateRequest *x509.CertificateRequest, rejectMessage string) {
+	trimmed := bytes.TrimSpace(data)
+	certificateRequestBytes, rest := pem.Decode(trimmed)
+	if certificateRequestBytes == nil {
+		return nil, "Request did not have a parseable PEM object"
+	}
+
+	if !bytes.HasPrefix(trimmed, []byte("-----BEGIN ")) {
+		return nil, "Request had text before the PEM object"
+	}
+
+	extraneousPemObject, _ := pem.Decode(rest)
+	if extraneousPemObject != nil {
+		return nil, "Request had more than one PEM object"
+	}
+
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, "Request had text after the PEM object"
+	}
+
+	if certificateRequestBytes.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Sprintf("Request had PEM object of type %q", certificateRequestBytes.Type)
+	}
+
+	if len(certificateRequestBytes.Headers) != 0 {
+		return nil, "Request had PEM headers"
+	}
+
+	certificateRequest, rejectMessage = parse(certificateRequestBytes.Bytes)
+	if rejectMessage != "" {
+		return nil, rejectMessage
+	}
+
+	if err := checkCanonicalDER(certificateRequestBytes.Bytes); err != nil {
+		return nil, fmt.Sprintf("Request was not canonical DER: %s", err)
+	}
+
+	attributes, err := attributeTypes(certificateRequest.RawTBSCertificateRequest)
+	if err == errUnsortedAttributes {
+		return nil, fmt.Sprintf("Request was not canonical DER: %s", err)
+	} else if err != nil {
+		return nil, fmt.Sprintf("Request had invalid attributes: %s", err)
+	}
+	seen := map[string]bool{}
+	for _, attribute := range attributes {
+		name, ok := attributeNames[attribute.String()]
+		if !ok {
+			name = attribute.String()
+		}
+		if seen[attribute.String()] {
+			return nil, fmt.Sprintf("Request had duplicate attribute %s", name)
+		}
+		seen[attribute.String()] = true
+		if !attribute.Equal(oidAttributeExtensionRequest) {
+			return nil, fmt.Sprintf("Request had unsupported attribute %s", name)
+		}
+	}
+
+	return verify(certificateRequest)
+}
+
+// checkCanonicalDER returns an error unless der is a single ASN.1 value that
+// re-encodes to exactly the same bytes under the DER rules.
+func checkCanonicalDER(der []byte) error {
+	var value asn1.RawValue
+	rest, err := asn1.Unmarshal(der, &value)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data")
+	}
+
+	encoded, err := reencode(value)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(encoded, der) {
+		return errors.New("encoding does not round-trip")
+	}
+	return nil
+}
+
+func reencode(value asn1.RawValue) ([]byte, error) {
+	content := value.Bytes
+	universal := value.Class == asn1.ClassUniversal
+
+	if value.IsCompound {
+		var children [][]byte
+		for rest := value.Bytes; len(rest) > 0; {
+			var child asn1.RawValue
+			var err error
+			rest, err = asn1.Unmarshal(rest, &child)
+			if err != nil {
+				return nil, err
+			}
+			encoded, err := reencode(child)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, encoded)
+		}
+		if universal && value.Tag == asn1.TagSet {
+			// DER orders the elements of a SET OF by their encodings.
+			sort.Slice(children, func(i, j int) bool {
+				return bytes.Compare(children[i], children[j]) < 0
+			})
+		}
+		content = bytes.Join(children, nil)
+	} else if universal {
+		switch value.Tag {
+		case asn1.TagBoolean:
+			if len(content) != 1 || (content[0] != 0 && content[0] != 0xff) {
+				return nil, errors.New("non-canonical BOOLEAN")
+			}
+		case asn1.TagInteger, asn1.TagEnum:
+			if len(content) == 0 ||
+				len(content) > 1 && (content[0] == 0 && content[1]&0x80 == 0 || content[0] == 0xff && content[1]&0x80 != 0) {
+				return nil, errors.New("non-minimal INTEGER")
+			}
+		}
+	}
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      value.Class,
+		Tag:        value.Tag,
+		IsCompound: value.IsCompound,
+		Bytes:      content,
+	})
+}
+
+// attributeTypes returns the types of the attributes in the CertificationRequestInfo tbs. The
+// attributes are implicitly tagged as [0], which reencode cannot tell from other uses of the tag,
+// so it returns errUnsortedAttributes if they are not in the order DER requires of a SET OF.
+func attributeTypes(tbs []byte) ([]asn1.ObjectIdentifier, error) {
+	var info struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(tbs, &info); err != nil {
+		return nil, err
+	}
+
+	var types []asn1.ObjectIdentifier
+	for i, rawAttribute := range info.RawAttributes {
+		if i > 0 && bytes.Compare(info.RawAttributes[i-1].FullBytes, rawAttribute.FullBytes) > 0 {
+			return nil, errUnsortedAttributes
+		}
+		var attribute struct {
+			Type   asn1.ObjectIdentifier
+			Values asn1.RawValue `asn1:"set"`
+		}
+		if _, err := asn1.Unmarshal(rawAttribute.FullBytes, &attribute); err != nil {
+			return nil, err
+		}
+		types = append(types, attribute.Type)
+	}
+	return types, nil
+}
@@ -0,0 +1,182 @@
+package altnames
+
+import (
+	"errors"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/san"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("altnames", &altnames{})
+}
+
+// Altnames is an Inspector that verifies all the Subject Alt Names in the CSR are permitted by a
+// static policy: DNS names must match a permitted pattern and may only be wildcards if the rule
+// permits them, IPs must be within a permitted network and there may be no more than a maximum
+// number of names. Rules may be scoped to requesting users or groups; the first scoped rule that
+// matches the requester applies, otherwise the unscoped rule.
+type altnames struct {
+	rules []*rule
+}
+
+type rule struct {
+	users      map[string]bool
+	groups     map[string]bool
+	dnsNames   []string
+	wildcards  bool
+	networks   []*net.IPNet
+	maxNames   int
+	hasOptions bool
+}
+
+func (a *altnames) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return a, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	current := &rule{maxNames: -1}
+	ret := altnames{rules: []*rule{current}}
+	for _, option := range options {
+		switch option.Key {
+		case "user", "group":
+			if current.hasOptions || len(ret.rules) == 1 {
+				current = &rule{maxNames: -1, users: map[string]bool{}, groups: map[string]bool{}}
+				ret.rules = append(ret.rules, current)
+			}
+			if option.Key == "user" {
+				current.users[option.Value] = true
+			} else {
+				current.groups[option.Value] = true
+			}
+			continue
+		case "dns":
+			pattern := strings.ToLower(option.Value)
+			if pattern == "" || pattern == "." || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+				return nil, fmt.Errorf("invalid dns %q", option.Value)
+			}
+			current.dnsNames = append(current.dnsNames, pattern)
+		case "wildcards":
+			current.wildcards, err = inspectors.ParseFlag(option)
+			if err != nil {
+				return nil, err
+			}
+		case "cidr":
+			_, network, err := net.ParseCIDR(option.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cidr %q", option.Value)
+			}
+			current.networks = append(current.networks, network)
+		case "maxnames":
+			current.maxNames, err = strconv.Atoi(option.Value)
+			if err != nil || current.maxNames < 0 {
+				return nil, fmt.Errorf("invalid maxnames %q", option.Value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+		current.hasOptions = true
+	}
+
+	return &ret, nil
+}
+
+func (a *altnames) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	if a.rules == nil {
+		return "", errors.New("altnames rules not configured")
+	}
+
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	names, msg := san.Parse(certificateRequest)
+	if msg != "" {
+		return msg, nil
+	}
+
+	r := a.ruleFor(request)
+	if r.maxNames >= 0 && len(names) > r.maxNames {
+		return fmt.Sprintf("Subject Alt Name has %d names, more than %d", len(names), r.maxNames), nil
+	}
+
+	var badNames []string
+	for _, name := range names {
+		if !r.permits(name) {
+			badNames = append(badNames, name.String())
+		}
+	}
+
+	if len(badNames) != 0 {
+		msg = "Subject Alt Name contains disallowed name"
+		if len(badNames) != 1 {
+			msg += "s"
+		}
+		return msg + ": " + strings.Join(badNames, ","), nil
+	}
+
+	return "", nil
+}
+
+func (a *altnames) ruleFor(request *certificates.CertificateSigningRequest) *rule {
+	for _, r := range a.rules[1:] {
+		if r.users[request.Spec.Username] {
+			return r
+		}
+		for _, group := range request.Spec.Groups {
+			if r.groups[group] {
+				return r
+			}
+		}
+	}
+	return a.rules[0]
+}
+
+func (r *rule) permits(name san.Name) bool {
+	switch name.Type {
+	case san.DNS:
+		dnsName := strings.ToLower(name.DNSName)
+		if strings.Contains(dnsName, "*") && (!r.wildcards || !strings.HasPrefix(dnsName, "*.") || strings.Contains(dnsName[1:], "*")) {
+			return false
+		}
+		for _, pattern := range r.dnsNames {
+			if matchDnsName(pattern, dnsName) {
+				return true
+			}
+		}
+	case san.IP:
+		for _, network := range r.networks {
+			if network.Contains(name.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchDnsName reports whether dnsName matches pattern. A pattern starting with "." matches names
+// with that suffix, a pattern starting with "*." matches names with exactly one more label, and any
+// other pattern must match exactly.
+func matchDnsName(pattern, dnsName string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "."):
+		return len(dnsName) > len(pattern) && strings.HasSuffix(dnsName, pattern) && !strings.HasPrefix(dnsName, ".")
+	case strings.HasPrefix(pattern, "*."):
+		label := strings.TrimSuffix(dnsName, pattern[1:])
+		return label != dnsName && label != "" && !strings.Contains(label, ".")
+	default:
+		return dnsName == pattern
+	}
+}
@@ -0,0 +1,188 @@
+package altnames_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/altnames"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("altnames")
+	require.True(t, exists, "inspectors.Get(\"altnames\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"dns=":            "invalid dns \"\"",
+		"dns=a.*.example": "invalid dns \"a.*.example\"",
+		"cidr=10.0.0.0":   "invalid cidr \"10.0.0.0\"",
+		"maxnames=-1":     "invalid maxnames \"-1\"",
+		"wildcards=maybe": "invalid wildcards \"maybe\"",
+		"ip=10.0.0.1":     "unsupported option \"ip\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+
+	_, err := inspector.Inspect(client, makeRequest(t, "someuser", nil, x509.CertificateRequest{}))
+	assert.EqualError(t, err, "altnames rules not configured", "unconfigured Inspect")
+}
+
+func TestInspect(t *testing.T) {
+	const config = "dns=.example.com,dns=*.wild.example.org,dns=exact.example.net,cidr=10.0.0.0/8,cidr=fd00::/8,maxnames=3," +
+		"user=admin,dns=.admin.example.com,cidr=192.168.0.0/16," +
+		"group=ops,group=sre,dns=.ops.example.com," +
+		"user=certmanager,dns=.apps.example.com,dns=*.wild.example.org,wildcards"
+
+	for _, testcase := range []struct {
+		name          string
+		username      string
+		groups        []string
+		dnsNames      []string
+		ips           []string
+		emails        []string
+		expectMessage string
+	}{
+		{
+			name: "NoNames",
+		},
+		{
+			name:     "Permitted",
+			dnsNames: []string{"www.example.com", "a.wild.example.org"},
+			ips:      []string{"10.1.2.3"},
+		},
+		{
+			name:     "CaseInsensitive",
+			dnsNames: []string{"WWW.Example.COM", "EXACT.example.net"},
+		},
+		{
+			name: "IPv6",
+			ips:  []string{"fd00::1"},
+		},
+		{
+			name:          "SuffixIsNotName",
+			dnsNames:      []string{"example.com", "notexample.com"},
+			expectMessage: "Subject Alt Name contains disallowed names: example.com,notexample.com",
+		},
+		{
+			name:          "WildcardOneLabel",
+			dnsNames:      []string{"wild.example.org", "a.b.wild.example.org"},
+			expectMessage: "Subject Alt Name contains disallowed names: wild.example.org,a.b.wild.example.org",
+		},
+		{
+			name:          "WildcardNotPermitted",
+			dnsNames:      []string{"*.example.com", "*.wild.example.org"},
+			expectMessage: "Subject Alt Name contains disallowed names: *.example.com,*.wild.example.org",
+		},
+		{
+			name:     "WildcardPermitted",
+			username: "certmanager",
+			dnsNames: []string{"*.apps.example.com", "*.a.apps.example.com", "*.wild.example.org"},
+		},
+		{
+			name:          "WildcardMalformed",
+			username:      "certmanager",
+			dnsNames:      []string{"a*.apps.example.com", "*.*.apps.example.com", "*.apps.example.com.*.apps.example.com", "*.b.wild.example.org"},
+			expectMessage: "Subject Alt Name contains disallowed names: a*.apps.example.com,*.*.apps.example.com,*.apps.example.com.*.apps.example.com,*.b.wild.example.org",
+		},
+		{
+			name:          "ExactOnly",
+			dnsNames:      []string{"sub.exact.example.net"},
+			expectMessage: "Subject Alt Name contains disallowed name: sub.exact.example.net",
+		},
+		{
+			name:          "OutsideCidr",
+			ips:           []string{"192.168.1.1"},
+			expectMessage: "Subject Alt Name contains disallowed name: 192.168.1.1",
+		},
+		{
+			name:          "OtherType",
+			emails:        []string{"nobody@example.com"},
+			expectMessage: "Subject Alt Name contains disallowed name: Name of type 1",
+		},
+		{
+			name:          "TooMany",
+			dnsNames:      []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"},
+			expectMessage: "Subject Alt Name has 4 names, more than 3",
+		},
+		{
+			name:     "ScopedUser",
+			username: "admin",
+			dnsNames: []string{"a.admin.example.com", "b.admin.example.com", "c.admin.example.com", "d.admin.example.com"},
+			ips:      []string{"192.168.1.1"},
+		},
+		{
+			name:          "ScopedUserReplacesUnscoped",
+			username:      "admin",
+			dnsNames:      []string{"www.example.com"},
+			expectMessage: "Subject Alt Name contains disallowed name: www.example.com",
+		},
+		{
+			name:     "ScopedGroup",
+			groups:   []string{"system:authenticated", "sre"},
+			dnsNames: []string{"a.ops.example.com"},
+		},
+		{
+			name:          "ScopedGroupNoIps",
+			groups:        []string{"ops"},
+			ips:           []string{"10.1.2.3"},
+			expectMessage: "Subject Alt Name contains disallowed name: 10.1.2.3",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("altnames")
+			require.True(t, exists, "inspectors.Get(\"altnames\") to exist")
+			inspector, err := inspector.Configure(config)
+			require.NoError(t, err, "Configure")
+
+			var ips []net.IP
+			for _, ip := range testcase.ips {
+				ips = append(ips, net.ParseIP(ip))
+			}
+			username := testcase.username
+			if username == "" {
+				username = "someuser"
+			}
+			request := makeRequest(t, username, testcase.groups, x509.CertificateRequest{
+				DNSNames:       testcase.dnsNames,
+				IPAddresses:    ips,
+				EmailAddresses: testcase.emails,
+			})
+
+			message, err := inspector.Inspect(client, request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err, "Error")
+		})
+	}
+}
+
+func makeRequest(t *testing.T, username string, groups []string, template x509.CertificateRequest) *certificates.CertificateSigningRequest {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	template.Subject = pkix.Name{CommonName: "example.invalid"}
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	return &certificates.CertificateSigningRequest{
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: username,
+			Groups:   groups,
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+		},
+	}
+}
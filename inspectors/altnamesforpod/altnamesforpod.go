@@ -1,45 +1,170 @@
 package altnamesforpod
 
 import (
-	"context"
-	"encoding/asn1"
 	"fmt"
+	"github.com/proofpoint/kapprover/clusterdomain"
 	"github.com/proofpoint/kapprover/csr"
 	"github.com/proofpoint/kapprover/inspectors"
 	"github.com/proofpoint/kapprover/podnames"
-	"github.com/sirupsen/logrus"
+	"github.com/proofpoint/kapprover/podresolver"
+	"github.com/proofpoint/kapprover/san"
+	"github.com/proofpoint/kapprover/spiffe"
 	certificates "k8s.io/api/certificates/v1beta1"
-	"k8s.io/api/core/v1"
-	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"net"
 	"strings"
 )
 
 func init() {
-	inspectors.Register("altnamesforpod", &altnamesforpod{clusterDomain: "cluster.local"})
-	inspectors.Register("altnamesforpodallowunqualified", &altnamesforpod{
-		clusterDomain:    "cluster.local",
-		allowUnqualified: true,
-	})
+	inspectors.Register("altnamesforpod", &altnamesforpod{})
+	inspectors.Register("altnamesforpodallowunqualified", &altnamesforpod{names: podnames.Options{AllowUnqualified: true}})
 }
 
 // AltNamesForPod is an Inspector that verifies all the Subject Alt Names in the CSR are appropriate
-// for the POD named in the subject
+// for the POD named in the subject. The only permitted URI is the SPIFFE ID derived from the POD's
+// namespace and service account. Unless configured with a cluster domain, it uses the global one.
+// Unless configured with schemes by which the request may name the POD, it must use the podip
+// scheme.
 type altnamesforpod struct {
-	clusterDomain    string
-	allowUnqualified bool
+	names             podnames.Options
+	spiffeTrustDomain string
+	spiffePath        string
+	resolvers         []podresolver.Resolver
 }
 
-var (
-	oidExtensionSubjectAltName = []int{2, 5, 29, 17}
+const (
+	defaultSpiffePath             = "/ns/{namespace}/sa/{serviceaccount}"
+	defaultLoadBalancerAnnotation = "kapprover.proofpoint.com/load-balancer-names"
+	defaultExternalDNSAnnotation  = "external-dns.alpha.kubernetes.io/hostname"
+	defaultClusterSetDomain       = "clusterset.local"
 )
 
+// optionNames are the names of the options, so that a lone option is not taken for a cluster domain.
+var optionNames = map[string]bool{
+	"clusterdomain":          true,
+	"allowunqualified":       true,
+	"endpointslices":         true,
+	"notreadyendpoints":      true,
+	"headlessservicenames":   true,
+	"clustersetdomain":       true,
+	"loadbalanceringress":    true,
+	"loadbalancerannotation": true,
+	"ingresses":              true,
+	"externaldnsannotation":  true,
+	"hostnamesuffix":         true,
+	"scheme":                 true,
+	"spiffetrustdomain":      true,
+	"spiffepath":             true,
+}
+
 func (a *altnamesforpod) Configure(config string) (inspectors.Inspector, error) {
-	if config != "" {
-		return &altnamesforpod{clusterDomain: config}, nil
+	if config == "" {
+		return a, nil
 	}
-	return a, nil
+	if !strings.ContainsAny(config, "=,") && !optionNames[strings.ToLower(strings.TrimSpace(config))] {
+		return &altnamesforpod{names: podnames.Options{ClusterDomain: config}}, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := altnamesforpod{names: podnames.Options{
+		ClusterDomain:    a.names.ClusterDomain,
+		AllowUnqualified: a.names.AllowUnqualified,
+	}}
+	var schemes []string
+	for _, option := range options {
+		switch option.Key {
+		case "clusterdomain":
+			if option.Value == "" {
+				return nil, fmt.Errorf("invalid clusterdomain %q", option.Value)
+			}
+			ret.names.ClusterDomain = option.Value
+		case "allowunqualified":
+			ret.names.AllowUnqualified, err = inspectors.ParseFlag(option)
+		case "endpointslices":
+			ret.names.EndpointSlices, err = inspectors.ParseFlag(option)
+		case "notreadyendpoints":
+			ret.names.NotReadyEndpoints, err = inspectors.ParseFlag(option)
+		case "headlessservicenames":
+			var permit bool
+			permit, err = inspectors.ParseFlag(option)
+			ret.names.OmitHeadlessServiceNames = !permit
+		case "clustersetdomain":
+			ret.names.ClusterSetDomain = option.Value
+			if ret.names.ClusterSetDomain == "" {
+				ret.names.ClusterSetDomain = defaultClusterSetDomain
+			}
+		case "loadbalanceringress":
+			ret.names.LoadBalancerIngress, err = inspectors.ParseFlag(option)
+		case "loadbalancerannotation":
+			ret.names.LoadBalancerAnnotation = option.Value
+			if ret.names.LoadBalancerAnnotation == "" {
+				ret.names.LoadBalancerAnnotation = defaultLoadBalancerAnnotation
+			}
+		case "ingresses":
+			ret.names.Ingresses, err = inspectors.ParseFlag(option)
+		case "externaldnsannotation":
+			ret.names.ExternalDNSAnnotation = option.Value
+			if ret.names.ExternalDNSAnnotation == "" {
+				ret.names.ExternalDNSAnnotation = defaultExternalDNSAnnotation
+			}
+		case "hostnamesuffix":
+			split := strings.SplitN(option.Value, ":", 2)
+			if len(split) != 2 || split[0] == "" || split[1] == "" || split[1] == "." {
+				return nil, fmt.Errorf("invalid hostnamesuffix %q", option.Value)
+			}
+			if ret.names.HostnameSuffixes == nil {
+				ret.names.HostnameSuffixes = map[string][]string{}
+			}
+			ret.names.HostnameSuffixes[split[0]] = append(ret.names.HostnameSuffixes[split[0]], split[1])
+		case "scheme":
+			schemes = append(schemes, option.Value)
+		case "spiffetrustdomain":
+			if err = spiffe.ValidateTrustDomain(option.Value); err != nil {
+				return nil, fmt.Errorf("invalid spiffetrustdomain %q: %v", option.Value, err)
+			}
+			ret.spiffeTrustDomain = option.Value
+		case "spiffepath":
+			ret.spiffePath = option.Value
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if schemes != nil {
+		if ret.resolvers, err = podresolver.Lookup(schemes); err != nil {
+			return nil, err
+		}
+	}
+	if ret.names.LoadBalancerAnnotation != "" && !ret.names.LoadBalancerIngress {
+		return nil, fmt.Errorf("loadbalancerannotation requires loadbalanceringress")
+	}
+	if ret.names.Ingresses && ret.names.HostnameSuffixes == nil {
+		return nil, fmt.Errorf("ingresses requires hostnamesuffix")
+	}
+	if ret.names.ExternalDNSAnnotation != "" && ret.names.HostnameSuffixes == nil {
+		return nil, fmt.Errorf("externaldnsannotation requires hostnamesuffix")
+	}
+	if ret.spiffePath != "" {
+		example := spiffeID("example.org", ret.spiffePath, "namespace", "serviceaccount")
+		if _, _, err := spiffe.Parse(example); err != nil || !strings.HasPrefix(ret.spiffePath, "/") || strings.ContainsAny(example, "{}") {
+			return nil, fmt.Errorf("invalid spiffepath %q", ret.spiffePath)
+		}
+	}
+
+	return &ret, nil
+}
+
+// spiffeID returns the SPIFFE ID in trustDomain for the path template and POD identity.
+func spiffeID(trustDomain, pathTemplate, namespace, serviceAccount string) string {
+	path := strings.NewReplacer("{namespace}", namespace, "{serviceaccount}", serviceAccount).Replace(pathTemplate)
+	return "spiffe://" + trustDomain + path
 }
 
 func (a *altnamesforpod) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
@@ -48,95 +173,51 @@ func (a *altnamesforpod) Inspect(client kubernetes.Interface, request *certifica
 		return msg, nil
 	}
 
-	podIp, namespace, msg := csr.GetPodIpAndNamespace(a.clusterDomain, certificateRequest)
-	if msg != "" {
-		return msg, nil
+	options := a.names
+	if options.ClusterDomain == "" {
+		options.ClusterDomain = clusterdomain.Get()
 	}
+	options.ClusterDomainAliases = clusterdomain.Aliases()
 
-	podList, err := client.CoreV1().Pods(namespace).List(context.TODO(), metaV1.ListOptions{FieldSelector: "status.podIP=" + podIp})
+	pod, msg, err := podresolver.Resolve(a.resolvers, client, request, certificateRequest, append([]string{options.ClusterDomain}, options.ClusterDomainAliases...))
+	if err != nil || msg != "" {
+		return msg, err
+	}
+
+	permittedDnsnames, permittedIps, err := podnames.GetNamesForPodWithOptions(client, *pod, options)
 	if err != nil {
 		return "", err
 	}
 
-	filtered := make([]v1.Pod, 0, 1)
-	for _, pod := range podList.Items {
-		if pod.DeletionTimestamp != nil {
-			continue
-		}
-		if pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodRunning {
-			continue
-		}
-		filtered = append(filtered, pod)
+	trustDomain := a.spiffeTrustDomain
+	if trustDomain == "" {
+		trustDomain = options.ClusterDomain
 	}
-
-	if len(filtered) == 0 {
-		return fmt.Sprintf("No pending or running POD in namespace %q with IP %q", namespace, podIp), nil
+	pathTemplate := a.spiffePath
+	if pathTemplate == "" {
+		pathTemplate = defaultSpiffePath
 	}
-	if len(filtered) > 1 {
-		logrus.Warnf("Altnamesforpod found multiple pods for IP %q", podIp)
-		for _, pod := range filtered {
-			logrus.Infof("Pod %+v", pod)
-		}
+	serviceAccount := pod.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
 	}
+	permittedUri := spiffeID(trustDomain, pathTemplate, pod.Namespace, serviceAccount)
 
-	permittedDnsnames, permittedIps, err := podnames.GetNamesForPod(client, filtered[0], a.clusterDomain, a.allowUnqualified)
-	if err != nil {
-		return "", err
+	names, msg := san.Parse(certificateRequest)
+	if msg != "" {
+		return msg, nil
 	}
 
 	var badNames []string
-
-	for _, extension := range certificateRequest.Extensions {
-		if !extension.Id.Equal(oidExtensionSubjectAltName) {
-			continue
-		}
-		var seq asn1.RawValue
-		var rest []byte
-		if rest, err = asn1.Unmarshal(extension.Value, &seq); err != nil {
-			return fmt.Sprintf("Could not parse SubjectAltName: %v", err), nil
-		} else if len(rest) != 0 {
-			return "Trailing data after X.509 SubjectAltName extension", nil
-		}
-		if !seq.IsCompound || seq.Tag != 16 || seq.Class != 0 {
-			return "Bad SubjectAltName sequence", nil
-		}
-
-		rest = seq.Bytes
-		for len(rest) > 0 {
-			var v asn1.RawValue
-			rest, err = asn1.Unmarshal(rest, &v)
-			if err != nil {
-				return fmt.Sprintf("Could not parse SubjectAltName: %v", err), nil
-			}
-			switch v.Tag {
-			case 2:
-				dnsName := string(v.Bytes)
-				found := false
-				for _, permittedDnsname := range permittedDnsnames {
-					if dnsName == permittedDnsname {
-						found = true
-						break
-					}
-				}
-				if !found {
-					badNames = append(badNames, dnsName)
-				}
-			case 7:
-				ip := net.IP(v.Bytes)
-				found := false
-				for _, permittedIp := range permittedIps {
-					if ip.Equal(permittedIp) {
-						found = true
-						break
-					}
-				}
-				if !found {
-					badNames = append(badNames, ip.String())
-				}
-			default:
-				badNames = append(badNames, fmt.Sprintf("Name of type %v", v.Tag))
+	for _, name := range names {
+		if name.Type == san.URI && strings.HasPrefix(strings.ToLower(name.URI), "spiffe:") {
+			if _, _, err := spiffe.Parse(name.URI); err != nil {
+				return fmt.Sprintf("Subject Alt Name URI %q is not a valid SPIFFE ID: %v", name.URI, err), nil
 			}
 		}
+		if !isPermitted(name, permittedDnsnames, permittedIps, permittedUri) {
+			badNames = append(badNames, name.String())
+		}
 	}
 
 	if len(badNames) != 0 {
@@ -151,3 +232,23 @@ func (a *altnamesforpod) Inspect(client kubernetes.Interface, request *certifica
 
 	return "", nil
 }
+
+func isPermitted(name san.Name, permittedDnsnames []string, permittedIps []net.IP, permittedUri string) bool {
+	switch name.Type {
+	case san.DNS:
+		for _, permittedDnsname := range permittedDnsnames {
+			if name.DNSName == permittedDnsname {
+				return true
+			}
+		}
+	case san.IP:
+		for _, permittedIp := range permittedIps {
+			if name.IP.Equal(permittedIp) {
+				return true
+			}
+		}
+	case san.URI:
+		return name.URI == permittedUri
+	}
+	return false
+}
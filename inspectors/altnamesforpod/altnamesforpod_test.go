@@ -6,20 +6,56 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"github.com/proofpoint/kapprover/clusterdomain"
 	"github.com/proofpoint/kapprover/inspectors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	certificates "k8s.io/api/certificates/v1beta1"
 	"k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 	"net"
+	"net/url"
 	"testing"
 
 	_ "github.com/proofpoint/kapprover/inspectors/group"
 )
 
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("altnamesforpod")
+	require.True(t, exists, "inspectors.Get(\"altnamesforpod\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"clusterdomain=":                        "invalid clusterdomain \"\"",
+		"allowunqualified=maybe":                "invalid allowunqualified \"maybe\"",
+		"endpointslices=maybe":                  "invalid endpointslices \"maybe\"",
+		"notreadyendpoints=maybe":               "invalid notreadyendpoints \"maybe\"",
+		"headlessservicenames=maybe":            "invalid headlessservicenames \"maybe\"",
+		"loadbalanceringress=maybe":             "invalid loadbalanceringress \"maybe\"",
+		"loadbalancerannotation=example.com/x":  "loadbalancerannotation requires loadbalanceringress",
+		"ingresses=maybe":                       "invalid ingresses \"maybe\"",
+		"ingresses=true":                        "ingresses requires hostnamesuffix",
+		"hostnamesuffix=.example.com":           "invalid hostnamesuffix \".example.com\"",
+		"externaldnsannotation,ingresses=false": "externaldnsannotation requires hostnamesuffix",
+		"hostnamesuffix=somenamespace:":         "invalid hostnamesuffix \"somenamespace:\"",
+		"hostnamesuffix=:.example.com":          "invalid hostnamesuffix \":.example.com\"",
+		"spiffetrustdomain=Example.org":         "invalid spiffetrustdomain \"Example.org\": trust domain has invalid character 'E'",
+		"spiffepath=ns/{namespace}":             "invalid spiffepath \"ns/{namespace}\"",
+		"spiffepath=/ns/{namespace}/{unknown}":  "invalid spiffepath \"/ns/{namespace}/{unknown}\"",
+		"spiffepath=/ns/{namespace}/":           "invalid spiffepath \"/ns/{namespace}/\"",
+		"scheme=unknown":                        "unsupported scheme \"unknown\", registered schemes: hostname,podip,san",
+		"ingresses":                             "ingresses requires hostnamesuffix",
+		"clusterdomain":                         "invalid clusterdomain \"\"",
+		"unknown=option":                        "unsupported option \"unknown\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
 func TestInspect(t *testing.T) {
 	key, err := rsa.GenerateKey(rand.Reader, 1024)
 	require.NoError(t, err, "Generate the private key")
@@ -35,6 +71,8 @@ func TestInspect(t *testing.T) {
 		setupRequest    func(request *x509.CertificateRequest)
 		podNamespace    string
 		podIp           string
+		globalDomain    string
+		globalAliases   []string
 		inspectorName   string
 	}{
 		{
@@ -125,9 +163,9 @@ func TestInspect(t *testing.T) {
 		},
 		{
 			name:          "IpMissingByte",
-			expectMessage: "Subject \"172--2-3.somenamespace.pod.cluster.local\" is not a POD-format name",
+			expectMessage: "Subject \"172-1-2-.somenamespace.pod.cluster.local\" is not a POD-format name",
 			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172--2-3.somenamespace.pod.cluster.local"
+				request.Subject.CommonName = "172-1-2-.somenamespace.pod.cluster.local"
 			},
 		},
 		// https://github.com/kubernetes/client-go/issues/326
@@ -225,6 +263,60 @@ func TestInspect(t *testing.T) {
 			},
 			expectMessage: "Subject Alt Name contains disallowed names: example.org,example.net,10.2.3.4,10.2.3.5",
 		},
+		{
+			name: "SpiffeId",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"172-1-0-3.somenamespace.pod.cluster.local"}
+				request.URIs = makeUris("spiffe://cluster.local/ns/somenamespace/sa/default")
+			},
+		},
+		{
+			name: "SpiffeIdWrongServiceAccount",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.URIs = makeUris("spiffe://cluster.local/ns/somenamespace/sa/someserviceaccount")
+			},
+			expectMessage: "Subject Alt Name contains disallowed name: spiffe://cluster.local/ns/somenamespace/sa/someserviceaccount",
+		},
+		{
+			name: "SpiffeIdWrongTrustDomain",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.URIs = makeUris("spiffe://example.org/ns/somenamespace/sa/default")
+			},
+			expectMessage: "Subject Alt Name contains disallowed name: spiffe://example.org/ns/somenamespace/sa/default",
+		},
+		{
+			name: "SpiffeIdInvalid",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.URIs = makeUris("spiffe://cluster.local/ns/somenamespace/sa/default/")
+			},
+			expectMessage: "Subject Alt Name URI \"spiffe://cluster.local/ns/somenamespace/sa/default/\" is not a valid SPIFFE ID: path has an empty segment",
+		},
+		{
+			name: "NonSpiffeUri",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.URIs = makeUris("https://example.org/ns/somenamespace/sa/default")
+			},
+			expectMessage: "Subject Alt Name contains disallowed name: https://example.org/ns/somenamespace/sa/default",
+		},
+		{
+			name:            "SpiffeIdConfigured",
+			inspectorConfig: "spiffetrustdomain=example.org,spiffepath=/k8s/{namespace}/{serviceaccount}",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.URIs = makeUris("spiffe://example.org/k8s/somenamespace/default")
+			},
+		},
+		{
+			name:            "OptionsClusterDomain",
+			inspectorConfig: "clusterdomain=example.com,allowunqualified",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.example.com"
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.example.com",
+					"tls-service.somenamespace.svc",
+				}
+				request.URIs = makeUris("spiffe://example.com/ns/somenamespace/sa/default")
+			},
+		},
 		{
 			name:            "ConfiguredNotInClusterDomain",
 			inspectorConfig: "example.com",
@@ -370,8 +462,766 @@ func TestInspect(t *testing.T) {
 				request.IPAddresses = makeIps("172.1.0.3", "10.0.0.1", "10.1.2.3", "10.1.2.4")
 			},
 		},
+		{
+			name:            "LoneOptionIsNotClusterDomain",
+			inspectorConfig: "endpointslices",
+		},
+		{
+			name:            "EndpointSliceService",
+			inspectorConfig: "endpointslices=true",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "manual-service",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						ClusterIP: "10.0.0.2",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+				&discovery.EndpointSlice{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "manual-service-abcde",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{discovery.LabelServiceName: "manual-service"},
+					},
+					AddressType: discovery.AddressTypeIPv4,
+					Endpoints: []discovery.Endpoint{{
+						Addresses: []string{"172.1.0.3"},
+						TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: "somenamespace", Name: "tls-app-579f7cd745-t6fdg"},
+					}},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"manual-service.somenamespace.svc.cluster.local",
+				}
+				request.IPAddresses = makeIps("172.1.0.3", "10.0.0.2")
+			},
+		},
+		{
+			name:            "HeadlessService",
+			inspectorConfig: "headlessservicenames=false",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "web-0",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "web"},
+					},
+					Spec: v1.PodSpec{
+						Hostname:  "web-0",
+						Subdomain: "web",
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "web",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "web"},
+						ClusterIP: v1.ClusterIPNone,
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"web-0.web.somenamespace.svc.cluster.local",
+					"172-1-0-3.web.somenamespace.svc.cluster.local",
+				}
+			},
+		},
+		{
+			name:            "HeadlessServiceName",
+			inspectorConfig: "headlessservicenames=false",
+			expectMessage:   "Subject Alt Name contains disallowed name: web.somenamespace.svc.cluster.local",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "web-0",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "web"},
+					},
+					Spec: v1.PodSpec{
+						Hostname:  "web-0",
+						Subdomain: "web",
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "web",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "web"},
+						ClusterIP: v1.ClusterIPNone,
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"web-0.web.somenamespace.svc.cluster.local",
+					"web.somenamespace.svc.cluster.local",
+				}
+			},
+		},
+		{
+			name: "DualStack",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase:  v1.PodRunning,
+						PodIP:  "172.1.0.3",
+						PodIPs: []v1.PodIP{{IP: "172.1.0.3"}, {IP: "fd00:10:244::3"}},
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-service",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:   map[string]string{"app": "some-app"},
+						ClusterIP:  "10.0.0.1",
+						ClusterIPs: []string{"10.0.0.1", "fd00:10:96::1"},
+						Type:       v1.ServiceTypeClusterIP,
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "fd00-10-244--3.somenamespace.pod.cluster.local"
+				request.DNSNames = []string{
+					"fd00-10-244--3.somenamespace.pod.cluster.local",
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"tls-service.somenamespace.svc.cluster.local",
+				}
+				request.IPAddresses = makeIps("fd00:10:244::3", "172.1.0.3", "10.0.0.1", "fd00:10:96::1")
+			},
+		},
+		{
+			name:          "DualStackWrongIp",
+			expectMessage: "Subject Alt Name contains disallowed name: fd00:10:96::2",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+					},
+					Status: v1.PodStatus{
+						Phase:  v1.PodRunning,
+						PodIP:  "172.1.0.3",
+						PodIPs: []v1.PodIP{{IP: "172.1.0.3"}, {IP: "fd00:10:244::3"}},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "fd00-10-244--3.somenamespace.pod.cluster.local"
+				request.IPAddresses = makeIps("fd00:10:244::3", "fd00:10:96::2")
+			},
+		},
+		{
+			name:            "LoadBalancerNotEnabled",
+			inspectorConfig: "clusterdomain=cluster.local",
+			expectMessage:   "Subject Alt Name contains disallowed names: a1b2c3.elb.example.com,192.0.2.1",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: nil,
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeLoadBalancer,
+					},
+					Status: v1.ServiceStatus{
+						LoadBalancer: v1.LoadBalancerStatus{
+							Ingress: []v1.LoadBalancerIngress{
+								{IP: "192.0.2.1"},
+								{Hostname: "a1b2c3.elb.example.com"},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"a1b2c3.elb.example.com",
+				}
+				request.IPAddresses = makeIps("172.1.0.3", "192.0.2.1")
+			},
+		},
+		{
+			name:            "LoadBalancerIngress",
+			inspectorConfig: "loadbalanceringress=true",
+			expectMessage:   "",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: nil,
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeLoadBalancer,
+					},
+					Status: v1.ServiceStatus{
+						LoadBalancer: v1.LoadBalancerStatus{
+							Ingress: []v1.LoadBalancerIngress{
+								{IP: "192.0.2.1"},
+								{Hostname: "a1b2c3.elb.example.com"},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"a1b2c3.elb.example.com",
+				}
+				request.IPAddresses = makeIps("172.1.0.3", "192.0.2.1")
+			},
+		},
+		{
+			name:            "LoadBalancerNotAnnotated",
+			inspectorConfig: "loadbalanceringress,loadbalancerannotation",
+			expectMessage:   "Subject Alt Name contains disallowed names: a1b2c3.elb.example.com,192.0.2.1",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: map[string]string{"kapprover.proofpoint.com/load-balancer-names": "false"},
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeLoadBalancer,
+					},
+					Status: v1.ServiceStatus{
+						LoadBalancer: v1.LoadBalancerStatus{
+							Ingress: []v1.LoadBalancerIngress{
+								{IP: "192.0.2.1"},
+								{Hostname: "a1b2c3.elb.example.com"},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"a1b2c3.elb.example.com",
+				}
+				request.IPAddresses = makeIps("172.1.0.3", "192.0.2.1")
+			},
+		},
+		{
+			name:            "LoadBalancerAnnotated",
+			inspectorConfig: "loadbalanceringress,loadbalancerannotation=example.com/cert-names",
+			expectMessage:   "",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: map[string]string{"example.com/cert-names": "true"},
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeLoadBalancer,
+					},
+					Status: v1.ServiceStatus{
+						LoadBalancer: v1.LoadBalancerStatus{
+							Ingress: []v1.LoadBalancerIngress{
+								{IP: "192.0.2.1"},
+								{Hostname: "a1b2c3.elb.example.com"},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"a1b2c3.elb.example.com",
+				}
+				request.IPAddresses = makeIps("172.1.0.3", "192.0.2.1")
+			},
+		},
+		{
+			name:            "IngressNotEnabled",
+			inspectorConfig: "clusterdomain=cluster.local",
+			expectMessage:   "Subject Alt Name contains disallowed name: app.team-a.example.com",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-service",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+				&networking.Ingress{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-ingress",
+						Namespace: "somenamespace",
+					},
+					Spec: networking.IngressSpec{
+						TLS: []networking.IngressTLS{{Hosts: []string{"app.team-a.example.com"}}},
+						Rules: []networking.IngressRule{
+							{
+								Host: "app.team-a.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+							{
+								Host: "app.team-b.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com"}
+			},
+		},
+		{
+			name:            "IngressHost",
+			inspectorConfig: "ingresses=true,hostnamesuffix=somenamespace:.team-a.example.com",
+			expectMessage:   "",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-service",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+				&networking.Ingress{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-ingress",
+						Namespace: "somenamespace",
+					},
+					Spec: networking.IngressSpec{
+						TLS: []networking.IngressTLS{{Hosts: []string{"app.team-a.example.com"}}},
+						Rules: []networking.IngressRule{
+							{
+								Host: "app.team-a.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+							{
+								Host: "app.team-b.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com"}
+			},
+		},
+		{
+			name:            "IngressHostNotInSuffixes",
+			inspectorConfig: "ingresses=true,hostnamesuffix=somenamespace:.team-a.example.com,hostnamesuffix=othernamespace:.team-b.example.com",
+			expectMessage:   "Subject Alt Name contains disallowed name: app.team-b.example.com",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-service",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+				&networking.Ingress{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-ingress",
+						Namespace: "somenamespace",
+					},
+					Spec: networking.IngressSpec{
+						TLS: []networking.IngressTLS{{Hosts: []string{"app.team-a.example.com"}}},
+						Rules: []networking.IngressRule{
+							{
+								Host: "app.team-a.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+							{
+								Host: "app.team-b.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com", "app.team-b.example.com"}
+			},
+		},
+		{
+			name:            "IngressHostAllNamespaces",
+			inspectorConfig: "ingresses=true,hostnamesuffix=*:.example.com",
+			expectMessage:   "",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-service",
+						Namespace: "somenamespace",
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+				&networking.Ingress{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-ingress",
+						Namespace: "somenamespace",
+					},
+					Spec: networking.IngressSpec{
+						TLS: []networking.IngressTLS{{Hosts: []string{"app.team-a.example.com"}}},
+						Rules: []networking.IngressRule{
+							{
+								Host: "app.team-a.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+							{
+								Host: "app.team-b.example.com",
+								IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{{
+										Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+									}},
+								}},
+							},
+						},
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com", "app.team-b.example.com"}
+			},
+		},
+		{
+			name:            "ExternalDNSNotEnabled",
+			inspectorConfig: "hostnamesuffix=somenamespace:.team-a.example.com",
+			expectMessage:   "Subject Alt Name contains disallowed name: app.team-a.example.com",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "app.team-a.example.com"},
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com"}
+			},
+		},
+		{
+			name:            "ExternalDNS",
+			inspectorConfig: "externaldnsannotation,hostnamesuffix=somenamespace:.team-a.example.com",
+			expectMessage:   "Subject Alt Name contains disallowed name: app.team-b.example.com",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "app.team-a.example.com, app.team-b.example.com"},
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com", "app.team-b.example.com"}
+			},
+		},
+		{
+			name:            "ExternalDNSConfiguredAnnotation",
+			inspectorConfig: "externaldnsannotation=example.com/hostnames,hostnamesuffix=*:.example.com",
+			expectMessage:   "",
+			objects: []runtime.Object{
+				&v1.Pod{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-app-579f7cd745-t6fdg",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{"app": "some-app"},
+					},
+					Status: v1.PodStatus{
+						Phase: v1.PodRunning,
+						PodIP: "172.1.0.3",
+					},
+				},
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:        "tls-service",
+						Namespace:   "somenamespace",
+						Annotations: map[string]string{"example.com/hostnames": "app.team-a.example.com,app.team-b.example.com"},
+					},
+					Spec: v1.ServiceSpec{
+						Selector:  map[string]string{"app": "some-app"},
+						ClusterIP: "10.0.0.1",
+						Type:      v1.ServiceTypeClusterIP,
+					},
+				},
+			},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"app.team-a.example.com", "app.team-b.example.com"}
+			},
+		},
+		{
+			name:         "GlobalClusterDomain",
+			globalDomain: "example.com",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.example.com"
+				request.DNSNames = []string{"172-1-0-3.somenamespace.pod.example.com"}
+			},
+		},
+		{
+			name:          "GlobalAlias",
+			globalAliases: []string{"old.example.com"},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.old.example.com"
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"172-1-0-3.somenamespace.pod.old.example.com",
+				}
+			},
+		},
+		{
+			name:            "SchemeSan",
+			inspectorConfig: "scheme=podip,scheme=san",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = ""
+				request.DNSNames = []string{
+					"172-1-0-3.somenamespace.pod.cluster.local",
+					"tls-service.somenamespace.svc.cluster.local",
+				}
+				request.IPAddresses = makeIps("172.1.0.3")
+			},
+		},
+		{
+			name:            "SchemeSanDisallowedName",
+			inspectorConfig: "scheme=san",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = ""
+				request.IPAddresses = makeIps("172.1.0.3", "10.2.3.4")
+			},
+			expectMessage: "Subject Alt Name contains disallowed name: 10.2.3.4",
+		},
+		{
+			name:          "SanWithoutScheme",
+			expectMessage: "Subject \"\" is not in the pod.cluster.local domain",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = ""
+				request.IPAddresses = makeIps("172.1.0.3")
+			},
+		},
 	} {
 		t.Run(testcase.name, func(t *testing.T) {
+			if testcase.globalDomain != "" || testcase.globalAliases != nil {
+				domain := testcase.globalDomain
+				if domain == "" {
+					domain = clusterdomain.Default
+				}
+				clusterdomain.Set(domain, testcase.globalAliases)
+				defer clusterdomain.Set(clusterdomain.Default, nil)
+			}
+
 			if testcase.inspectorName == "" {
 				testcase.inspectorName = "altnamesforpod"
 			}
@@ -462,6 +1312,18 @@ func TestInspect(t *testing.T) {
 	}
 }
 
+func makeUris(uris ...string) []*url.URL {
+	var urilist []*url.URL
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			panic(err)
+		}
+		urilist = append(urilist, parsed)
+	}
+	return urilist
+}
+
 func makeIps(ips ...string) []net.IP {
 	var iplist []net.IP
 	for _, ip := range ips {
@@ -0,0 +1,181 @@
+package bootstraptoken
+
+import (
+	"context"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	inspectors.Register("bootstraptoken", &bootstraptoken{nodeAnnotation: defaultNodeAnnotation})
+}
+
+// Bootstraptoken is an Inspector that verifies requests from bootstrap token users
+// (system:bootstrap:<token-id>) against the token's Secret in kube-system. The token must
+// exist, be unexpired and usable for authentication. It can be configured to require the
+// requester's system:bootstrappers groups to match the token's auth-extra-groups, and to
+// require the subject to be the system:node:<name> named in an annotation on the token's Secret.
+// Requests from other users are ignored.
+type bootstraptoken struct {
+	enforceGroups  bool
+	enforceNode    bool
+	nodeAnnotation string
+}
+
+const (
+	bootstrapUserPrefix   = "system:bootstrap:"
+	bootstrapGroup        = "system:bootstrappers"
+	nodeUserPrefix        = "system:node:"
+	secretNamespace       = "kube-system"
+	secretNamePrefix      = "bootstrap-token-"
+	secretType            = "bootstrap.kubernetes.io/token"
+	defaultNodeAnnotation = "kapprover.proofpoint.com/node-name"
+)
+
+var tokenIdRegexp = regexp.MustCompile(`^[a-z0-9]{6}$`)
+
+func (b *bootstraptoken) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return b, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := bootstraptoken{nodeAnnotation: defaultNodeAnnotation}
+	for _, option := range options {
+		switch option.Key {
+		case "enforcegroups":
+			ret.enforceGroups, err = inspectors.ParseFlag(option)
+		case "enforcenode":
+			ret.enforceNode, err = inspectors.ParseFlag(option)
+		case "nodeannotation":
+			if option.Value == "" {
+				return nil, fmt.Errorf("invalid %s %q", option.Key, option.Value)
+			}
+			ret.nodeAnnotation = option.Value
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ret, nil
+}
+
+func (b *bootstraptoken) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	if !strings.HasPrefix(request.Spec.Username, bootstrapUserPrefix) {
+		return "", nil
+	}
+
+	tokenId := strings.TrimPrefix(request.Spec.Username, bootstrapUserPrefix)
+	if !tokenIdRegexp.MatchString(tokenId) {
+		return fmt.Sprintf("Requesting user %q does not have a valid bootstrap token ID", request.Spec.Username), nil
+	}
+
+	secretName := secretNamePrefix + tokenId
+	secret, err := client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		return fmt.Sprintf("No bootstrap token Secret %q", secretName), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if secret.Type != secretType {
+		return fmt.Sprintf("Secret %q is not of type %s", secretName, secretType), nil
+	}
+	if secret.DeletionTimestamp != nil {
+		return fmt.Sprintf("Bootstrap token %q is being deleted", tokenId), nil
+	}
+	if string(secret.Data["token-id"]) != tokenId {
+		return fmt.Sprintf("Secret %q is not for bootstrap token %q", secretName, tokenId), nil
+	}
+	if string(secret.Data["usage-bootstrap-authentication"]) != "true" {
+		return fmt.Sprintf("Bootstrap token %q is not permitted for authentication", tokenId), nil
+	}
+	if expiration, ok := secret.Data["expiration"]; ok {
+		expires, err := time.Parse(time.RFC3339, string(expiration))
+		if err != nil {
+			return fmt.Sprintf("Bootstrap token %q has invalid expiration %q", tokenId, expiration), nil
+		}
+		if time.Now().After(expires) {
+			return fmt.Sprintf("Bootstrap token %q expired at %s", tokenId, expires.Format(time.RFC3339)), nil
+		}
+	}
+
+	if b.enforceGroups {
+		if msg := checkGroups(tokenId, secret, request.Spec.Groups); msg != "" {
+			return msg, nil
+		}
+	}
+
+	if b.enforceNode {
+		nodeName := secret.Annotations[b.nodeAnnotation]
+		if nodeName == "" {
+			return fmt.Sprintf("Bootstrap token %q is not bound to a node", tokenId), nil
+		}
+
+		certificateRequest, msg := csr.Extract(request.Spec.Request)
+		if msg != "" {
+			return msg, nil
+		}
+		if certificateRequest.Subject.CommonName != nodeUserPrefix+nodeName {
+			return fmt.Sprintf("Subject common name %q is not %q", certificateRequest.Subject.CommonName, nodeUserPrefix+nodeName), nil
+		}
+	}
+
+	return "", nil
+}
+
+func checkGroups(tokenId string, secret *v1.Secret, requestGroups []string) string {
+	tokenGroups := map[string]bool{bootstrapGroup: true}
+	if extraGroups := string(secret.Data["auth-extra-groups"]); extraGroups != "" {
+		for _, group := range strings.Split(extraGroups, ",") {
+			tokenGroups[strings.TrimSpace(group)] = true
+		}
+	}
+
+	var unexpected []string
+	found := map[string]bool{}
+	for _, group := range requestGroups {
+		if group != bootstrapGroup && !strings.HasPrefix(group, bootstrapGroup+":") {
+			continue
+		}
+		if tokenGroups[group] {
+			found[group] = true
+		} else {
+			unexpected = append(unexpected, group)
+		}
+	}
+	if len(unexpected) != 0 {
+		return fmt.Sprintf("Requesting user is in groups %s not granted by bootstrap token %q", strings.Join(unexpected, ","), tokenId)
+	}
+
+	var missing []string
+	for group := range tokenGroups {
+		if !found[group] {
+			missing = append(missing, group)
+		}
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return fmt.Sprintf("Requesting user is not in groups %s granted by bootstrap token %q", strings.Join(missing, ","), tokenId)
+	}
+
+	return ""
+}
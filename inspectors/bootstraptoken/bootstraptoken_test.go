@@ -0,0 +1,232 @@
+package bootstraptoken_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+
+	_ "github.com/proofpoint/kapprover/inspectors/bootstraptoken"
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("bootstraptoken")
+	require.True(t, exists, "inspectors.Get(\"bootstraptoken\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"enforcegroups=sometimes": "invalid enforcegroups \"sometimes\"",
+		"enforcenode=maybe":       "invalid enforcenode \"maybe\"",
+		"nodeannotation":          "invalid nodeannotation \"\"",
+		"other":                   "unsupported option \"other\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	for _, testcase := range []struct {
+		name            string
+		inspectorConfig string
+		expectMessage   string
+		username        string
+		groups          []string
+		commonName      string
+		setupSecret     func(secret *v1.Secret)
+	}{
+		{
+			name: "Good",
+		},
+		{
+			name:     "NotBootstrapUser",
+			username: "system:node:somenode",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Name = "other"
+			},
+		},
+		{
+			name:          "InvalidTokenId",
+			username:      "system:bootstrap:ABCDEF",
+			expectMessage: "Requesting user \"system:bootstrap:ABCDEF\" does not have a valid bootstrap token ID",
+		},
+		{
+			name:          "NoSecret",
+			username:      "system:bootstrap:zyxwvu",
+			expectMessage: "No bootstrap token Secret \"bootstrap-token-zyxwvu\"",
+		},
+		{
+			name: "WrongType",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Type = v1.SecretTypeOpaque
+			},
+			expectMessage: "Secret \"bootstrap-token-abcdef\" is not of type bootstrap.kubernetes.io/token",
+		},
+		{
+			name: "Deleted",
+			setupSecret: func(secret *v1.Secret) {
+				now := metaV1.Now()
+				secret.DeletionTimestamp = &now
+			},
+			expectMessage: "Bootstrap token \"abcdef\" is being deleted",
+		},
+		{
+			name: "WrongTokenId",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Data["token-id"] = []byte("zyxwvu")
+			},
+			expectMessage: "Secret \"bootstrap-token-abcdef\" is not for bootstrap token \"abcdef\"",
+		},
+		{
+			name: "NotForAuthentication",
+			setupSecret: func(secret *v1.Secret) {
+				delete(secret.Data, "usage-bootstrap-authentication")
+			},
+			expectMessage: "Bootstrap token \"abcdef\" is not permitted for authentication",
+		},
+		{
+			name: "NoExpiration",
+			setupSecret: func(secret *v1.Secret) {
+				delete(secret.Data, "expiration")
+			},
+		},
+		{
+			name: "Expired",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Data["expiration"] = []byte("2017-03-10T03:22:11Z")
+			},
+			expectMessage: "Bootstrap token \"abcdef\" expired at 2017-03-10T03:22:11Z",
+		},
+		{
+			name: "InvalidExpiration",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Data["expiration"] = []byte("tomorrow")
+			},
+			expectMessage: "Bootstrap token \"abcdef\" has invalid expiration \"tomorrow\"",
+		},
+		{
+			name:            "EnforceGroups",
+			inspectorConfig: "enforcegroups",
+		},
+		{
+			name:            "EnforceGroupsExtraGroup",
+			inspectorConfig: "enforcegroups",
+			groups:          []string{"system:bootstrappers", "system:bootstrappers:worker", "system:bootstrappers:master", "system:authenticated"},
+			expectMessage:   "Requesting user is in groups system:bootstrappers:master not granted by bootstrap token \"abcdef\"",
+		},
+		{
+			name:            "EnforceGroupsMissingGroup",
+			inspectorConfig: "enforcegroups=true",
+			groups:          []string{"system:bootstrappers", "system:authenticated"},
+			expectMessage:   "Requesting user is not in groups system:bootstrappers:worker granted by bootstrap token \"abcdef\"",
+		},
+		{
+			name:   "ExtraGroupNotEnforced",
+			groups: []string{"system:bootstrappers", "system:bootstrappers:master"},
+		},
+		{
+			name:            "EnforceNode",
+			inspectorConfig: "enforcenode",
+		},
+		{
+			name:            "EnforceNodeWrongNode",
+			inspectorConfig: "enforcenode",
+			commonName:      "system:node:othernode",
+			expectMessage:   "Subject common name \"system:node:othernode\" is not \"system:node:somenode\"",
+		},
+		{
+			name:            "EnforceNodeNoAnnotation",
+			inspectorConfig: "enforcenode",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Annotations = nil
+			},
+			expectMessage: "Bootstrap token \"abcdef\" is not bound to a node",
+		},
+		{
+			name:            "EnforceNodeConfiguredAnnotation",
+			inspectorConfig: "enforcenode,nodeannotation=example.com/node",
+			commonName:      "system:node:othernode",
+			setupSecret: func(secret *v1.Secret) {
+				secret.Annotations["example.com/node"] = "othernode"
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("bootstraptoken")
+			require.True(t, exists, "inspectors.Get(\"bootstraptoken\") to exist")
+
+			if testcase.inspectorConfig != "" {
+				var err error
+				inspector, err = inspector.Configure(testcase.inspectorConfig)
+				require.NoError(t, err, "Configure")
+			}
+
+			secret := v1.Secret{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      "bootstrap-token-abcdef",
+					Namespace: "kube-system",
+					Annotations: map[string]string{
+						"kapprover.proofpoint.com/node-name": "somenode",
+					},
+				},
+				Type: "bootstrap.kubernetes.io/token",
+				Data: map[string][]byte{
+					"token-id":                       []byte("abcdef"),
+					"token-secret":                   []byte("0123456789abcdef"),
+					"expiration":                     []byte(time.Now().Add(time.Hour).UTC().Format(time.RFC3339)),
+					"usage-bootstrap-authentication": []byte("true"),
+					"usage-bootstrap-signing":        []byte("true"),
+					"auth-extra-groups":              []byte("system:bootstrappers:worker"),
+				},
+			}
+			if testcase.setupSecret != nil {
+				testcase.setupSecret(&secret)
+			}
+			client := fake.NewSimpleClientset(&secret)
+
+			if testcase.commonName == "" {
+				testcase.commonName = "system:node:somenode"
+			}
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName:   testcase.commonName,
+					Organization: []string{"system:nodes"},
+				},
+				SignatureAlgorithm: x509.ECDSAWithSHA256,
+			}
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: testcase.username,
+					Groups:   testcase.groups,
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+			if request.Spec.Username == "" {
+				request.Spec.Username = "system:bootstrap:abcdef"
+			}
+			if request.Spec.Groups == nil {
+				request.Spec.Groups = []string{"system:bootstrappers", "system:bootstrappers:worker", "system:authenticated"}
+			}
+
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/review"
+	"github.com/sirupsen/logrus"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	inspectors.Register("exec", &execInspector{})
+}
+
+// Exec is an Inspector that delegates the decision to a local command. The command is
+// given a review.Review describing the CSR on its standard input. Exiting with status 0
+// takes no action, exiting with status 1 takes adverse action with the command's standard
+// output as the message, and anything else, including running past the timeout, is an error.
+// The command runs with only the configured environment; its standard error is logged.
+type execInspector struct {
+	command string
+	args    []string
+	env     []string
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+const (
+	defaultPath   = "PATH=/usr/local/bin:/usr/bin:/bin"
+	maxOutputSize = 64 * 1024
+	// How long to wait for a killed command's output to be closed. A child that left the
+	// command's process group may hold it open indefinitely.
+	killWait = 2 * time.Second
+)
+
+func (e *execInspector) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return e, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := execInspector{timeout: 10 * time.Second}
+	concurrency := 4
+	hasPath := false
+	for _, option := range options {
+		switch option.Key {
+		case "command":
+			if !filepath.IsAbs(option.Value) {
+				return nil, fmt.Errorf("command %q is not an absolute path", option.Value)
+			}
+			ret.command = option.Value
+		case "arg":
+			ret.args = append(ret.args, option.Value)
+		case "env":
+			if !strings.Contains(option.Value, "=") {
+				return nil, fmt.Errorf("env %q is not of the form NAME=value", option.Value)
+			}
+			hasPath = hasPath || strings.HasPrefix(option.Value, "PATH=")
+			ret.env = append(ret.env, option.Value)
+		case "timeout":
+			ret.timeout, err = time.ParseDuration(option.Value)
+			if err != nil || ret.timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout %q", option.Value)
+			}
+		case "concurrency":
+			concurrency, err = strconv.Atoi(option.Value)
+			if err != nil || concurrency < 1 {
+				return nil, fmt.Errorf("invalid concurrency %q", option.Value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+	}
+
+	if ret.command == "" {
+		return nil, errors.New("command must be configured")
+	}
+	if !hasPath {
+		ret.env = append(ret.env, defaultPath)
+	}
+	ret.slots = make(chan struct{}, concurrency)
+
+	return &ret, nil
+}
+
+func (e *execInspector) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	if e.command == "" {
+		return "", errors.New("exec command not configured")
+	}
+
+	csrReview, msg := review.New(request)
+	if msg != "" {
+		return msg, nil
+	}
+	input, err := json.Marshal(csrReview)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	select {
+	case e.slots <- struct{}{}:
+		defer func() { <-e.slots }()
+	case <-ctx.Done():
+		return "", fmt.Errorf("timed out waiting to run %s", e.command)
+	}
+
+	stdout := limitedBuffer{limit: maxOutputSize}
+	stderr := limitedBuffer{limit: maxOutputSize}
+	cmd := osexec.Command(e.command, e.args...)
+	cmd.Env = e.env
+	cmd.Dir = "/"
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+
+	if err = cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		select {
+		case <-done:
+			e.logStderr(request, stderr.String())
+		case <-time.After(killWait):
+			// Wait is still copying the output, so it cannot be read.
+			logrus.Warnf("Exec %s for %q: output still open %s after kill", e.command, request.Name, killWait)
+		}
+		return "", fmt.Errorf("%s timed out after %s", e.command, e.timeout)
+	}
+
+	e.logStderr(request, stderr.String())
+
+	if err == nil {
+		return "", nil
+	}
+	if exitErr, ok := err.(*osexec.ExitError); ok && exitErr.ExitCode() == 1 {
+		message := strings.TrimSpace(stdout.String())
+		if message == "" {
+			message = fmt.Sprintf("Denied by %s", e.command)
+		}
+		return message, nil
+	}
+	return "", fmt.Errorf("%s failed: %v", e.command, err)
+}
+
+func (e *execInspector) logStderr(request *certificates.CertificateSigningRequest, stderr string) {
+	scanner := bufio.NewScanner(strings.NewReader(stderr))
+	for scanner.Scan() {
+		logrus.Infof("Exec %s for %q: %s", e.command, request.Name, scanner.Text())
+	}
+}
+
+// limitedBuffer is a bytes.Buffer that discards anything written past its limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := l.limit - l.Len(); remaining < len(p) {
+		if remaining > 0 {
+			l.Buffer.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return l.Buffer.Write(p)
+}
@@ -0,0 +1,205 @@
+package exec_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/review"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	_ "github.com/proofpoint/kapprover/inspectors/exec"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("exec")
+	require.True(t, exists, "inspectors.Get(\"exec\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"timeout=5s":                       "command must be configured",
+		"command=policy.sh":                "command \"policy.sh\" is not an absolute path",
+		"command=/bin/true,env=FOO":        "env \"FOO\" is not of the form NAME=value",
+		"command=/bin/true,timeout=0s":     "invalid timeout \"0s\"",
+		"command=/bin/true,concurrency=0":  "invalid concurrency \"0\"",
+		"command=/bin/true,unknown=option": "unsupported option \"unknown\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+
+	_, err := inspector.Inspect(client, makeRequest(t))
+	assert.EqualError(t, err, "exec command not configured", "unconfigured Inspect")
+}
+
+func TestInspect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test scripts require a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "exec")
+	require.NoError(t, err, "TempDir")
+	defer func() {
+		assert.NoError(t, os.RemoveAll(dir))
+	}()
+
+	for _, testcase := range []struct {
+		name          string
+		script        string
+		requires      string
+		config        string
+		expectMessage string
+		expectErr     string
+	}{
+		{
+			name:   "Allowed",
+			script: "cat >/dev/null; echo ignored",
+		},
+		{
+			name:          "Denied",
+			script:        "cat >/dev/null; echo '  Not on my watch '; exit 1",
+			expectMessage: "Not on my watch",
+		},
+		{
+			name:          "DeniedNoMessage",
+			script:        "exit 1",
+			expectMessage: "Denied by " + filepath.Join(dir, "DeniedNoMessage"),
+		},
+		{
+			name:      "Failed",
+			script:    "echo something went wrong >&2; exit 2",
+			expectErr: filepath.Join(dir, "Failed") + " failed: exit status 2",
+		},
+		{
+			name:          "Arguments",
+			script:        "echo \"$1 $2\"; exit 1",
+			config:        ",arg=first,arg=second",
+			expectMessage: "first second",
+		},
+		{
+			name:          "StrippedEnvironment",
+			script:        "echo \"HOME=$HOME PATH=$PATH FOO=$FOO\"; exit 1",
+			config:        ",env=FOO=bar",
+			expectMessage: "HOME= PATH=/usr/local/bin:/usr/bin:/bin FOO=bar",
+		},
+		{
+			name:          "ConfiguredPath",
+			script:        "echo \"PATH=$PATH\"; exit 1",
+			config:        ",env=PATH=/bin",
+			expectMessage: "PATH=/bin",
+		},
+		{
+			name:      "Timeout",
+			script:    "sleep 10 & sleep 10",
+			config:    ",timeout=200ms",
+			expectErr: filepath.Join(dir, "Timeout") + " timed out after 200ms",
+		},
+		{
+			name:      "TimeoutOutputHeldOpen",
+			script:    "setsid sleep 10 & sleep 10",
+			requires:  "setsid",
+			config:    ",timeout=200ms",
+			expectErr: filepath.Join(dir, "TimeoutOutputHeldOpen") + " timed out after 200ms",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if testcase.requires != "" {
+				if _, err := osexec.LookPath(testcase.requires); err != nil {
+					t.Skipf("test script requires %s", testcase.requires)
+				}
+			}
+
+			command := filepath.Join(dir, testcase.name)
+			require.NoError(t, ioutil.WriteFile(command, []byte("#!/bin/sh\n"+testcase.script+"\n"), 0700))
+
+			inspector, exists := inspectors.Get("exec")
+			require.True(t, exists, "inspectors.Get(\"exec\") to exist")
+			inspector, err := inspector.Configure("command=" + command + testcase.config)
+			require.NoError(t, err, "Configure")
+
+			start := time.Now()
+			message, err := inspector.Inspect(client, makeRequest(t))
+			assert.True(t, time.Since(start) < 5*time.Second, "returned promptly")
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			if testcase.expectErr == "" {
+				assert.NoError(t, err, "Error")
+			} else {
+				assert.EqualError(t, err, testcase.expectErr, "Error")
+			}
+		})
+	}
+}
+
+func TestInspectReview(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test scripts require a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "exec")
+	require.NoError(t, err, "TempDir")
+	defer func() {
+		assert.NoError(t, os.RemoveAll(dir))
+	}()
+
+	command := filepath.Join(dir, "echo-review")
+	require.NoError(t, ioutil.WriteFile(command, []byte("#!/bin/sh\ncat\nexit 1\n"), 0700))
+
+	inspector, exists := inspectors.Get("exec")
+	require.True(t, exists, "inspectors.Get(\"exec\") to exist")
+	inspector, err = inspector.Configure("command=" + command)
+	require.NoError(t, err, "Configure")
+
+	request := makeRequest(t)
+	message, err := inspector.Inspect(client, request)
+	require.NoError(t, err, "Error")
+
+	var received review.Review
+	require.NoError(t, json.Unmarshal([]byte(message), &received), "decode review")
+	assert.Equal(t, "somerequest", received.Name, "review name")
+	assert.Equal(t, "system:serviceaccount:somenamespace:someaccount", received.Username, "review username")
+	assert.Equal(t, string(request.Spec.Request), received.Request, "review request")
+	assert.Equal(t, "example.invalid", received.CertificateRequest.Subject.CommonName, "review CN")
+}
+
+func makeRequest(t *testing.T) *certificates.CertificateSigningRequest {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err, "Generate the private key")
+
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	return &certificates.CertificateSigningRequest{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name: "somerequest",
+			UID:  "someuid",
+		},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: "system:serviceaccount:somenamespace:someaccount",
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+		},
+	}
+}
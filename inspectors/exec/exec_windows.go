@@ -0,0 +1,12 @@
+package exec
+
+import (
+	osexec "os/exec"
+)
+
+func setProcessGroup(cmd *osexec.Cmd) {
+}
+
+func killProcessGroup(cmd *osexec.Cmd) {
+	cmd.Process.Kill()
+}
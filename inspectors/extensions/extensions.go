@@ -0,0 +1,268 @@
+package extensions
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("extensions", &extensions{map[string]criticality{
+		oidSubjectAltName.String(): eitherCritical,
+	}})
+}
+
+// Extensions is an Inspector that verifies that the CSR has only permitted X.509 extensions,
+// each with a permitted critical flag. KeyUsage and ExtendedKeyUsage extensions must not contain
+// usages that were not requested in the CSR's usages and a BasicConstraints extension must not
+// have CA set.
+type extensions struct {
+	permitted map[string]criticality
+}
+
+type criticality int
+
+const (
+	eitherCritical criticality = iota
+	mustBeCritical
+	mustNotBeCritical
+)
+
+var (
+	oidSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
+var supportedExtensions = map[string]asn1.ObjectIdentifier{
+	"subjectaltname":       oidSubjectAltName,
+	"keyusage":             oidKeyUsage,
+	"extkeyusage":          oidExtKeyUsage,
+	"extendedkeyusage":     oidExtKeyUsage,
+	"basicconstraints":     oidBasicConstraints,
+	"subjectkeyidentifier": {2, 5, 29, 14},
+	"nameconstraints":      {2, 5, 29, 30},
+	"certificatepolicies":  {2, 5, 29, 32},
+	"authorityinfoaccess":  {1, 3, 6, 1, 5, 5, 7, 1, 1},
+	"tlsfeature":           {1, 3, 6, 1, 5, 5, 7, 1, 24},
+}
+
+// keyUsageBits lists, for each bit of the KeyUsage extension, the requested usages that permit it.
+var keyUsageBits = []struct {
+	name   string
+	usages []certificates.KeyUsage
+}{
+	{"digitalSignature", []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageSigning}},
+	{"contentCommitment", []certificates.KeyUsage{certificates.UsageContentCommitment}},
+	{"keyEncipherment", []certificates.KeyUsage{certificates.UsageKeyEncipherment}},
+	{"dataEncipherment", []certificates.KeyUsage{certificates.UsageDataEncipherment}},
+	{"keyAgreement", []certificates.KeyUsage{certificates.UsageKeyAgreement}},
+	{"keyCertSign", []certificates.KeyUsage{certificates.UsageCertSign}},
+	{"cRLSign", []certificates.KeyUsage{certificates.UsageCRLSign}},
+	{"encipherOnly", []certificates.KeyUsage{certificates.UsageEncipherOnly}},
+	{"decipherOnly", []certificates.KeyUsage{certificates.UsageDecipherOnly}},
+}
+
+// extKeyUsages maps the OIDs of extended key usages to the requested usages that permit them.
+var extKeyUsages = map[string][]certificates.KeyUsage{
+	"2.5.29.37.0":            {certificates.UsageAny},
+	"1.3.6.1.5.5.7.3.1":      {certificates.UsageServerAuth},
+	"1.3.6.1.5.5.7.3.2":      {certificates.UsageClientAuth},
+	"1.3.6.1.5.5.7.3.3":      {certificates.UsageCodeSigning},
+	"1.3.6.1.5.5.7.3.4":      {certificates.UsageEmailProtection, certificates.UsageSMIME},
+	"1.3.6.1.5.5.7.3.5":      {certificates.UsageIPsecEndSystem},
+	"1.3.6.1.5.5.7.3.6":      {certificates.UsageIPsecTunnel},
+	"1.3.6.1.5.5.7.3.7":      {certificates.UsageIPsecUser},
+	"1.3.6.1.5.5.7.3.8":      {certificates.UsageTimestamping},
+	"1.3.6.1.5.5.7.3.9":      {certificates.UsageOCSPSigning},
+	"1.3.6.1.4.1.311.10.3.3": {certificates.UsageMicrosoftSGC},
+	"2.16.840.1.113730.4.1":  {certificates.UsageNetscapeSGC},
+}
+
+func (e *extensions) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return e, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := extensions{permitted: map[string]criticality{}}
+	for _, option := range options {
+		var critical criticality
+		switch option.Key {
+		case "allow":
+			critical = eitherCritical
+		case "critical":
+			critical = mustBeCritical
+		case "noncritical":
+			critical = mustNotBeCritical
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+
+		oid, err := parseExtension(option.Value)
+		if err != nil {
+			return nil, err
+		}
+		ret.permitted[oid.String()] = critical
+	}
+
+	return &ret, nil
+}
+
+func parseExtension(value string) (asn1.ObjectIdentifier, error) {
+	if oid, ok := supportedExtensions[strings.ToLower(value)]; ok {
+		return oid, nil
+	}
+
+	components := strings.Split(value, ".")
+	if len(components) < 2 {
+		return nil, fmt.Errorf("unsupported extension %q", value)
+	}
+	oid := make(asn1.ObjectIdentifier, len(components))
+	for i, component := range components {
+		n, err := strconv.Atoi(component)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("unsupported extension %q", value)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+func (e *extensions) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	seen := map[string]bool{}
+	for _, extension := range certificateRequest.Extensions {
+		if seen[extension.Id.String()] {
+			return fmt.Sprintf("Contains X.509 extension %s more than once", extension.Id), nil
+		}
+		seen[extension.Id.String()] = true
+	}
+
+	numBad := 0
+	bad := ""
+	sep := " "
+	for _, extension := range certificateRequest.Extensions {
+		if _, ok := e.permitted[extension.Id.String()]; !ok {
+			bad += sep + extension.Id.String()
+			sep = ","
+			numBad++
+		}
+	}
+
+	if numBad > 0 {
+		msg = "Contains X.509 extension"
+		if numBad > 1 {
+			msg += "s"
+		}
+		return msg + bad, nil
+	}
+
+	requested := map[certificates.KeyUsage]bool{}
+	for _, usage := range request.Spec.Usages {
+		requested[usage] = true
+	}
+
+	for _, extension := range certificateRequest.Extensions {
+		switch e.permitted[extension.Id.String()] {
+		case mustBeCritical:
+			if !extension.Critical {
+				return fmt.Sprintf("X.509 extension %s must be critical", extension.Id), nil
+			}
+		case mustNotBeCritical:
+			if extension.Critical {
+				return fmt.Sprintf("X.509 extension %s must not be critical", extension.Id), nil
+			}
+		}
+
+		switch {
+		case extension.Id.Equal(oidKeyUsage):
+			msg = inspectKeyUsage(extension.Value, requested)
+		case extension.Id.Equal(oidExtKeyUsage):
+			msg = inspectExtKeyUsage(extension.Value, requested)
+		case extension.Id.Equal(oidBasicConstraints):
+			msg = inspectBasicConstraints(extension.Value)
+		}
+		if msg != "" {
+			return msg, nil
+		}
+	}
+
+	return "", nil
+}
+
+func inspectKeyUsage(value []byte, requested map[certificates.KeyUsage]bool) string {
+	var bits asn1.BitString
+	if rest, err := asn1.Unmarshal(value, &bits); err != nil || len(rest) != 0 {
+		return "Invalid KeyUsage extension"
+	}
+
+	for i := 0; i < bits.BitLength; i++ {
+		if bits.At(i) == 0 {
+			continue
+		}
+		if i >= len(keyUsageBits) {
+			return fmt.Sprintf("KeyUsage extension has unsupported bit %d", i)
+		}
+		if !anyRequested(keyUsageBits[i].usages, requested) {
+			return fmt.Sprintf("KeyUsage extension has %s, which is not a requested usage", keyUsageBits[i].name)
+		}
+	}
+	return ""
+}
+
+func inspectExtKeyUsage(value []byte, requested map[certificates.KeyUsage]bool) string {
+	var oids []asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(value, &oids); err != nil || len(rest) != 0 {
+		return "Invalid ExtendedKeyUsage extension"
+	}
+
+	for _, oid := range oids {
+		usages, ok := extKeyUsages[oid.String()]
+		if !ok {
+			return fmt.Sprintf("ExtendedKeyUsage extension has unsupported usage %s", oid)
+		}
+		if !anyRequested(usages, requested) {
+			return fmt.Sprintf("ExtendedKeyUsage extension has %s, which is not a requested usage", usages[0])
+		}
+	}
+	return ""
+}
+
+func inspectBasicConstraints(value []byte) string {
+	var basicConstraints struct {
+		IsCA       bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}
+	if rest, err := asn1.Unmarshal(value, &basicConstraints); err != nil || len(rest) != 0 {
+		return "Invalid BasicConstraints extension"
+	}
+
+	if basicConstraints.IsCA {
+		return "BasicConstraints extension has CA=true"
+	}
+	return ""
+}
+
+func anyRequested(usages []certificates.KeyUsage, requested map[certificates.KeyUsage]bool) bool {
+	for _, usage := range usages {
+		if requested[usage] {
+			return true
+		}
+	}
+	return false
+}
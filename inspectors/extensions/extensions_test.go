@@ -0,0 +1,236 @@
+package extensions_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/extensions"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+var (
+	oidKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidNameConstraints  = asn1.ObjectIdentifier{2, 5, 29, 30}
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("extensions")
+	require.True(t, exists, "inspectors.Get(\"extensions\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"allow=nosuchextension": "unsupported extension \"nosuchextension\"",
+		"allow=1.2.x":           "unsupported extension \"1.2.x\"",
+		"critical=1":            "unsupported extension \"1\"",
+		"deny=keyusage":         "unsupported option \"deny\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	keyUsage := func(bits ...int) []byte {
+		bitString := asn1.BitString{Bytes: make([]byte, 2), BitLength: 9}
+		for _, bit := range bits {
+			bitString.Bytes[bit/8] |= 0x80 >> uint(bit%8)
+		}
+		value, err := asn1.Marshal(bitString)
+		require.NoError(t, err, "Marshal KeyUsage")
+		return value
+	}
+	extKeyUsage := func(oids ...asn1.ObjectIdentifier) []byte {
+		value, err := asn1.Marshal(oids)
+		require.NoError(t, err, "Marshal ExtendedKeyUsage")
+		return value
+	}
+	basicConstraints := func(isCA bool) []byte {
+		value, err := asn1.Marshal(struct {
+			IsCA bool `asn1:"optional"`
+		}{isCA})
+		require.NoError(t, err, "Marshal BasicConstraints")
+		return value
+	}
+	serverAuth := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	clientAuth := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+	serverUsages := []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment, certificates.UsageServerAuth}
+
+	for _, testcase := range []struct {
+		name          string
+		config        string
+		usages        []certificates.KeyUsage
+		extensions    []pkix.Extension
+		expectMessage string
+	}{
+		{
+			name: "DefaultSubjectAltNameOnly",
+		},
+		{
+			name:          "DefaultKeyUsage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidKeyUsage, Value: keyUsage(0, 2)}},
+			expectMessage: "Contains X.509 extension 2.5.29.15",
+		},
+		{
+			name:          "NotAllowed",
+			config:        "allow=subjectaltname,allow=keyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidKeyUsage, Value: keyUsage(0)}, {Id: oidBasicConstraints, Value: basicConstraints(false)}, {Id: oidNameConstraints, Value: []byte{0x30, 0}}},
+			expectMessage: "Contains X.509 extensions 2.5.29.19,2.5.29.30",
+		},
+		{
+			name:       "ByOID",
+			config:     "allow=2.5.29.17,allow=2.5.29.30",
+			extensions: []pkix.Extension{{Id: oidNameConstraints, Value: []byte{0x30, 0}}},
+		},
+		{
+			name:       "KeyUsageConsistent",
+			config:     "allow=SubjectAltName,critical=KeyUsage,allow=ExtKeyUsage",
+			usages:     serverUsages,
+			extensions: []pkix.Extension{{Id: oidKeyUsage, Critical: true, Value: keyUsage(0, 2)}, {Id: oidExtKeyUsage, Value: extKeyUsage(serverAuth)}},
+		},
+		{
+			name:       "KeyUsageSigning",
+			config:     "allow=subjectaltname,allow=keyusage",
+			usages:     []certificates.KeyUsage{certificates.UsageSigning},
+			extensions: []pkix.Extension{{Id: oidKeyUsage, Value: keyUsage(0)}},
+		},
+		{
+			name:          "KeyUsageNotRequested",
+			config:        "allow=subjectaltname,allow=keyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidKeyUsage, Value: keyUsage(0, 5)}},
+			expectMessage: "KeyUsage extension has keyCertSign, which is not a requested usage",
+		},
+		{
+			name:          "KeyUsageMustBeCritical",
+			config:        "allow=subjectaltname,critical=keyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidKeyUsage, Value: keyUsage(0)}},
+			expectMessage: "X.509 extension 2.5.29.15 must be critical",
+		},
+		{
+			name:          "KeyUsageMustNotBeCritical",
+			config:        "allow=subjectaltname,noncritical=keyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidKeyUsage, Critical: true, Value: keyUsage(0)}},
+			expectMessage: "X.509 extension 2.5.29.15 must not be critical",
+		},
+		{
+			name:          "InvalidKeyUsage",
+			config:        "allow=subjectaltname,allow=keyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidKeyUsage, Value: []byte{0x05, 0x00}}},
+			expectMessage: "Invalid KeyUsage extension",
+		},
+		{
+			name:          "ExtKeyUsageNotRequested",
+			config:        "allow=subjectaltname,allow=extendedkeyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidExtKeyUsage, Value: extKeyUsage(serverAuth, clientAuth)}},
+			expectMessage: "ExtendedKeyUsage extension has client auth, which is not a requested usage",
+		},
+		{
+			name:          "ExtKeyUsageUnsupported",
+			config:        "allow=subjectaltname,allow=extkeyusage",
+			usages:        serverUsages,
+			extensions:    []pkix.Extension{{Id: oidExtKeyUsage, Value: extKeyUsage(asn1.ObjectIdentifier{1, 2, 3, 4})}},
+			expectMessage: "ExtendedKeyUsage extension has unsupported usage 1.2.3.4",
+		},
+		{
+			name:       "BasicConstraintsNotCA",
+			config:     "allow=subjectaltname,allow=basicconstraints",
+			extensions: []pkix.Extension{{Id: oidBasicConstraints, Critical: true, Value: basicConstraints(false)}},
+		},
+		{
+			name:          "BasicConstraintsCA",
+			config:        "allow=subjectaltname,allow=basicconstraints",
+			extensions:    []pkix.Extension{{Id: oidBasicConstraints, Critical: true, Value: basicConstraints(true)}},
+			expectMessage: "BasicConstraints extension has CA=true",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("extensions")
+			require.True(t, exists, "inspectors.Get(\"extensions\") to exist")
+			inspector, err := inspector.Configure(testcase.config)
+			require.NoError(t, err, "Configure")
+
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "example.invalid",
+				},
+				SignatureAlgorithm: x509.SHA256WithRSA,
+				DNSNames:           []string{"example.invalid"},
+				ExtraExtensions:    testcase.extensions,
+			}
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: "someRandomUser",
+					Usages:   testcase.usages,
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err, "Error")
+		})
+	}
+}
+
+func TestInspectDuplicateExtension(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	inspector, exists := inspectors.Get("extensions")
+	require.True(t, exists, "inspectors.Get(\"extensions\") to exist")
+	inspector, err = inspector.Configure("allow=subjectaltname,allow=basicconstraints")
+	require.NoError(t, err, "Configure")
+
+	notCA, err := asn1.Marshal(struct {
+		IsCA bool `asn1:"optional"`
+	}{})
+	require.NoError(t, err, "Marshal BasicConstraints")
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidBasicConstraints, Value: notCA},
+			{Id: oidBasicConstraints, Value: notCA},
+		},
+	}
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	request := certificates.CertificateSigningRequest{
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: "someRandomUser",
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+		},
+	}
+	message, err := inspector.Inspect(client, &request)
+	assert.NoError(t, err, "Error")
+	// Newer Go releases already reject the request when parsing it.
+	assert.Regexp(t, "^(Contains X.509 extension 2.5.29.19 more than once|Request had invalid certificate request: .*duplicate.*)$", message, "Message")
+}
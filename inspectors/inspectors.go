@@ -1,6 +1,7 @@
 package inspectors
 
 import (
+	"strconv"
 	"strings"
 	"sync"
 
@@ -75,6 +76,48 @@ func (inspectors *Inspectors) Set(value string) error {
 	return nil
 }
 
+// Option is a single key=value setting in an inspector's configuration.
+type Option struct {
+	Key   string
+	Value string
+}
+
+// ParseOptions splits a configuration of the form "key=value,key=value" into its options,
+// for inspectors that take more than one setting. Keys are lowercased; a key may be repeated
+// to supply a list of values. An item without an "=" has an empty value.
+func ParseOptions(config string) ([]Option, error) {
+	var options []Option
+	if config == "" {
+		return options, nil
+	}
+	for _, item := range strings.Split(config, ",") {
+		split := strings.SplitN(item, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(split[0]))
+		if key == "" {
+			return nil, errors.New(fmt.Sprintf("option %q has no name", item))
+		}
+		option := Option{Key: key}
+		if len(split) > 1 {
+			option.Value = split[1]
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// ParseFlag returns the boolean value of an option, which is true if the option is given
+// without a value.
+func ParseFlag(option Option) (bool, error) {
+	if option.Value == "" {
+		return true, nil
+	}
+	value, err := strconv.ParseBool(option.Value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", option.Key, option.Value)
+	}
+	return value, nil
+}
+
 // Register makes an Inspector available by the provided name.
 //
 // If called twice with the same name, the name is blank, or if the provided
@@ -37,3 +37,39 @@ func TestInspectors(t *testing.T) {
 	i = inspectors.Inspectors{}
 	assert.Error(i.Set("notonlist"))
 }
+
+func TestParseOptions(t *testing.T) {
+	options, err := inspectors.ParseOptions("")
+	assert.NoError(t, err)
+	assert.Empty(t, options, "empty config")
+
+	options, err = inspectors.ParseOptions("url=https://example.invalid/?a=b,FailOpen,timeout=5s,group=a,group=b")
+	assert.NoError(t, err)
+	assert.Equal(t, []inspectors.Option{
+		{Key: "url", Value: "https://example.invalid/?a=b"},
+		{Key: "failopen"},
+		{Key: "timeout", Value: "5s"},
+		{Key: "group", Value: "a"},
+		{Key: "group", Value: "b"},
+	}, options)
+
+	_, err = inspectors.ParseOptions("url=x,=y")
+	assert.EqualError(t, err, "option \"=y\" has no name")
+}
+
+func TestParseFlag(t *testing.T) {
+	for option, expect := range map[inspectors.Option]bool{
+		{Key: "failopen"}:                 true,
+		{Key: "failopen", Value: "true"}:  true,
+		{Key: "failopen", Value: "1"}:     true,
+		{Key: "failopen", Value: "false"}: false,
+		{Key: "failopen", Value: "0"}:     false,
+	} {
+		value, err := inspectors.ParseFlag(option)
+		assert.NoError(t, err, "%+v", option)
+		assert.Equal(t, expect, value, "%+v", option)
+	}
+
+	_, err := inspectors.ParseFlag(inspectors.Option{Key: "failopen", Value: "sometimes"})
+	assert.EqualError(t, err, "invalid failopen \"sometimes\"")
+}
@@ -0,0 +1,168 @@
+package kubeletclient
+
+import (
+	"context"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/san"
+	certificates "k8s.io/api/certificates/v1beta1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("kubeletclient", &kubeletclient{
+		bootstrapGroups: []string{"system:kubelet-bootstrap"},
+		allowBootstrap:  true,
+		allowRenewal:    true,
+	})
+}
+
+// Kubeletclient is an Inspector that verifies a kubelet client certificate request, following
+// the kube-controller-manager "nodeclient" and "selfnodeclient" rules. The subject must be
+// CN=system:node:<name>,O=system:nodes with no Subject Alt Names and client auth usages.
+// A bootstrap request must come from a user in one of the bootstrap groups; a renewal must come
+// from the node named in the subject and can be required to be for an existing Node.
+type kubeletclient struct {
+	bootstrapGroups []string
+	allowBootstrap  bool
+	allowRenewal    bool
+	requireNode     bool
+}
+
+const (
+	nodeUserPrefix = "system:node:"
+	nodesGroup     = "system:nodes"
+)
+
+var permittedUsages = map[certificates.KeyUsage]bool{
+	certificates.UsageDigitalSignature: true,
+	certificates.UsageKeyEncipherment:  true,
+	certificates.UsageClientAuth:       true,
+}
+
+func (k *kubeletclient) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return k, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := kubeletclient{
+		allowBootstrap: true,
+		allowRenewal:   true,
+	}
+	for _, option := range options {
+		switch option.Key {
+		case "bootstrapgroup":
+			ret.bootstrapGroups = append(ret.bootstrapGroups, option.Value)
+		case "bootstrap":
+			ret.allowBootstrap, err = inspectors.ParseFlag(option)
+		case "renewal":
+			ret.allowRenewal, err = inspectors.ParseFlag(option)
+		case "requirenode":
+			ret.requireNode, err = inspectors.ParseFlag(option)
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ret.bootstrapGroups == nil {
+		ret.bootstrapGroups = k.bootstrapGroups
+	}
+
+	return &ret, nil
+}
+
+func (k *kubeletclient) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	hasClientAuth := false
+	hasDigitalSignature := false
+	for _, usage := range request.Spec.Usages {
+		if !permittedUsages[usage] {
+			return fmt.Sprintf("Contains key usage %s", usage), nil
+		}
+		hasClientAuth = hasClientAuth || usage == certificates.UsageClientAuth
+		hasDigitalSignature = hasDigitalSignature || usage == certificates.UsageDigitalSignature
+	}
+	if !hasClientAuth {
+		return fmt.Sprintf("Does not contain key usage %s", certificates.UsageClientAuth), nil
+	}
+	if !hasDigitalSignature {
+		return fmt.Sprintf("Does not contain key usage %s", certificates.UsageDigitalSignature), nil
+	}
+
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	subject := certificateRequest.Subject.CommonName
+	if !strings.HasPrefix(subject, nodeUserPrefix) || subject == nodeUserPrefix {
+		return fmt.Sprintf("Subject common name %q is not a node", subject), nil
+	}
+	if len(certificateRequest.Subject.Organization) != 1 || certificateRequest.Subject.Organization[0] != nodesGroup {
+		return fmt.Sprintf("Subject organization %q is not [%s]", certificateRequest.Subject.Organization, nodesGroup), nil
+	}
+	if len(certificateRequest.Subject.Names) != 2 {
+		return "Subject has name components other than CN and O", nil
+	}
+	names, msg := san.Parse(certificateRequest)
+	if msg != "" {
+		return msg, nil
+	}
+	if len(names) != 0 {
+		return "Contains Subject Alt Names", nil
+	}
+
+	if !strings.HasPrefix(request.Spec.Username, nodeUserPrefix) {
+		if !k.allowBootstrap {
+			return fmt.Sprintf("Requesting user %q is not %q and bootstrap requests are not permitted", request.Spec.Username, subject), nil
+		}
+		for _, group := range request.Spec.Groups {
+			for _, bootstrapGroup := range k.bootstrapGroups {
+				if group == bootstrapGroup {
+					return "", nil
+				}
+			}
+		}
+		return fmt.Sprintf("Requesting user is not in the %s group", strings.Join(k.bootstrapGroups, " or ")), nil
+	}
+
+	if !k.allowRenewal {
+		return "Renewal requests are not permitted", nil
+	}
+	if request.Spec.Username != subject {
+		return fmt.Sprintf("Requesting node %q is not %q", request.Spec.Username, subject), nil
+	}
+	inGroup := false
+	for _, group := range request.Spec.Groups {
+		if group == nodesGroup {
+			inGroup = true
+			break
+		}
+	}
+	if !inGroup {
+		return fmt.Sprintf("Requesting user is not in the %s group", nodesGroup), nil
+	}
+
+	if k.requireNode {
+		nodeName := strings.TrimPrefix(subject, nodeUserPrefix)
+		_, err := client.CoreV1().Nodes().Get(context.TODO(), nodeName, metaV1.GetOptions{})
+		if apiErrors.IsNotFound(err) {
+			return fmt.Sprintf("No Node named %q", nodeName), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
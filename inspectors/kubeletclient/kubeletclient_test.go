@@ -0,0 +1,230 @@
+package kubeletclient_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/kubeletclient"
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("kubeletclient")
+	require.True(t, exists, "inspectors.Get(\"kubeletclient\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"bootstrap=sometimes": "invalid bootstrap \"sometimes\"",
+		"requirenode=maybe":   "invalid requirenode \"maybe\"",
+		"other=value":         "unsupported option \"other\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	for _, testcase := range []struct {
+		name            string
+		inspectorConfig string
+		expectMessage   string
+		username        string
+		groups          []string
+		usages          []certificates.KeyUsage
+		setupRequest    func(request *x509.CertificateRequest)
+	}{
+		{
+			name: "Bootstrap",
+		},
+		{
+			name:     "Renewal",
+			username: "system:node:somenode",
+			groups:   []string{"system:nodes", "system:authenticated"},
+		},
+		{
+			name:   "BootstrapWithoutKeyEncipherment",
+			usages: []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageClientAuth},
+		},
+		{
+			name:          "ServerAuth",
+			usages:        []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageClientAuth, certificates.UsageServerAuth},
+			expectMessage: "Contains key usage server auth",
+		},
+		{
+			name:          "NoClientAuth",
+			usages:        []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment},
+			expectMessage: "Does not contain key usage client auth",
+		},
+		{
+			name:          "NoDigitalSignature",
+			usages:        []certificates.KeyUsage{certificates.UsageKeyEncipherment, certificates.UsageClientAuth},
+			expectMessage: "Does not contain key usage digital signature",
+		},
+		{
+			name: "NotNodeSubject",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "somenode"
+			},
+			expectMessage: "Subject common name \"somenode\" is not a node",
+		},
+		{
+			name: "WrongOrganization",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.Organization = []string{"system:masters"}
+			},
+			expectMessage: "Subject organization [\"system:masters\"] is not [system:nodes]",
+		},
+		{
+			name: "ExtraSubjectComponent",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.Country = []string{"US"}
+			},
+			expectMessage: "Subject has name components other than CN and O",
+		},
+		{
+			name: "AltName",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.IPAddresses = []net.IP{net.ParseIP("10.0.0.1")}
+			},
+			expectMessage: "Contains Subject Alt Names",
+		},
+		{
+			name:          "BootstrapWrongGroup",
+			groups:        []string{"system:authenticated"},
+			expectMessage: "Requesting user is not in the system:kubelet-bootstrap group",
+		},
+		{
+			name:            "BootstrapConfiguredGroups",
+			inspectorConfig: "bootstrapgroup=system:bootstrappers,bootstrapgroup=system:bootstrappers:worker",
+			groups:          []string{"system:bootstrappers:worker", "system:authenticated"},
+		},
+		{
+			name:            "BootstrapConfiguredGroupsWrongGroup",
+			inspectorConfig: "bootstrapgroup=system:bootstrappers,bootstrapgroup=system:bootstrappers:worker",
+			expectMessage:   "Requesting user is not in the system:bootstrappers or system:bootstrappers:worker group",
+		},
+		{
+			name:            "BareFlags",
+			inspectorConfig: "bootstrap,renewal",
+		},
+		{
+			name:            "BootstrapNotPermitted",
+			inspectorConfig: "bootstrap=false",
+			expectMessage:   "Requesting user \"kubelet-bootstrap\" is not \"system:node:somenode\" and bootstrap requests are not permitted",
+		},
+		{
+			name:            "RenewalNotPermitted",
+			inspectorConfig: "renewal=false",
+			username:        "system:node:somenode",
+			groups:          []string{"system:nodes"},
+			expectMessage:   "Renewal requests are not permitted",
+		},
+		{
+			name:          "RenewalOtherNode",
+			username:      "system:node:othernode",
+			groups:        []string{"system:nodes"},
+			expectMessage: "Requesting node \"system:node:othernode\" is not \"system:node:somenode\"",
+		},
+		{
+			name:          "RenewalNotInGroup",
+			username:      "system:node:somenode",
+			groups:        []string{"system:authenticated"},
+			expectMessage: "Requesting user is not in the system:nodes group",
+		},
+		{
+			name:            "RenewalRequireNode",
+			inspectorConfig: "requirenode",
+			username:        "system:node:somenode",
+			groups:          []string{"system:nodes"},
+		},
+		{
+			name:            "RenewalRequireNodeMissing",
+			inspectorConfig: "requirenode=true",
+			username:        "system:node:deletednode",
+			groups:          []string{"system:nodes"},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "system:node:deletednode"
+			},
+			expectMessage: "No Node named \"deletednode\"",
+		},
+		{
+			name:     "RenewalMissingNode",
+			username: "system:node:deletednode",
+			groups:   []string{"system:nodes"},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "system:node:deletednode"
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("kubeletclient")
+			require.True(t, exists, "inspectors.Get(\"kubeletclient\") to exist")
+
+			if testcase.inspectorConfig != "" {
+				var err error
+				inspector, err = inspector.Configure(testcase.inspectorConfig)
+				require.NoError(t, err, "Configure")
+			}
+
+			client := fake.NewSimpleClientset(&v1.Node{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name: "somenode",
+				},
+			})
+
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName:   "system:node:somenode",
+					Organization: []string{"system:nodes"},
+				},
+				SignatureAlgorithm: x509.ECDSAWithSHA256,
+			}
+			if testcase.setupRequest != nil {
+				testcase.setupRequest(&certificateRequestTemplate)
+			}
+
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: testcase.username,
+					Groups:   testcase.groups,
+					Usages:   testcase.usages,
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+			if request.Spec.Username == "" {
+				request.Spec.Username = "kubelet-bootstrap"
+			}
+			if request.Spec.Groups == nil {
+				request.Spec.Groups = []string{"system:kubelet-bootstrap", "system:authenticated"}
+			}
+			if request.Spec.Usages == nil {
+				request.Spec.Usages = []certificates.KeyUsage{
+					certificates.UsageDigitalSignature,
+					certificates.UsageKeyEncipherment,
+					certificates.UsageClientAuth,
+				}
+			}
+
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err)
+		})
+	}
+}
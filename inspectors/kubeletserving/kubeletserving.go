@@ -0,0 +1,157 @@
+package kubeletserving
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/san"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("kubeletserving", &kubeletserving{})
+}
+
+// Kubeletserving is an Inspector that verifies a kubelet serving certificate request.
+// The requester must be system:node:<name> in the system:nodes group, the subject must be
+// CN=system:node:<name>,O=system:nodes for an existing Node, every DNS and IP Subject Alt Name
+// must be one of that Node's status addresses, and the usages must be limited to server auth
+// with digital signature and key encipherment.
+type kubeletserving struct {
+}
+
+const (
+	nodeUserPrefix = "system:node:"
+	nodesGroup     = "system:nodes"
+)
+
+var permittedUsages = map[certificates.KeyUsage]bool{
+	certificates.UsageDigitalSignature: true,
+	certificates.UsageKeyEncipherment:  true,
+	certificates.UsageServerAuth:       true,
+}
+
+func (k *kubeletserving) Configure(config string) (inspectors.Inspector, error) {
+	if config != "" {
+		return nil, errors.New("configuration not supported")
+	}
+	return k, nil
+}
+
+func (k *kubeletserving) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	if !strings.HasPrefix(request.Spec.Username, nodeUserPrefix) || request.Spec.Username == nodeUserPrefix {
+		return fmt.Sprintf("Requesting user %q is not a node", request.Spec.Username), nil
+	}
+	nodeName := strings.TrimPrefix(request.Spec.Username, nodeUserPrefix)
+
+	inGroup := false
+	for _, group := range request.Spec.Groups {
+		if group == nodesGroup {
+			inGroup = true
+			break
+		}
+	}
+	if !inGroup {
+		return fmt.Sprintf("Requesting user is not in the %s group", nodesGroup), nil
+	}
+
+	hasServerAuth := false
+	for _, usage := range request.Spec.Usages {
+		if !permittedUsages[usage] {
+			return fmt.Sprintf("Contains key usage %s", usage), nil
+		}
+		if usage == certificates.UsageServerAuth {
+			hasServerAuth = true
+		}
+	}
+	if !hasServerAuth {
+		return fmt.Sprintf("Does not contain key usage %s", certificates.UsageServerAuth), nil
+	}
+
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	if certificateRequest.Subject.CommonName != request.Spec.Username {
+		return fmt.Sprintf("Subject common name %q is not %q", certificateRequest.Subject.CommonName, request.Spec.Username), nil
+	}
+	if len(certificateRequest.Subject.Organization) != 1 || certificateRequest.Subject.Organization[0] != nodesGroup {
+		return fmt.Sprintf("Subject organization %q is not [%s]", certificateRequest.Subject.Organization, nodesGroup), nil
+	}
+	if len(certificateRequest.Subject.Names) != 2 {
+		return "Subject has name components other than CN and O", nil
+	}
+
+	names, msg := san.Parse(certificateRequest)
+	if msg != "" {
+		return msg, nil
+	}
+	for _, name := range names {
+		if name.Type != san.DNS && name.Type != san.IP {
+			return "Subject Alt Name contains names other than DNS names and IPs", nil
+		}
+	}
+	if len(names) == 0 {
+		return "Subject Alt Name contains no DNS names or IPs", nil
+	}
+
+	node, err := client.CoreV1().Nodes().Get(context.TODO(), nodeName, metaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		return fmt.Sprintf("No Node named %q", nodeName), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var badNames []string
+	for _, name := range names {
+		if name.Type == san.DNS && !hasAddress(node, name.DNSName) || name.Type == san.IP && !hasIp(node, name.IP) {
+			badNames = append(badNames, name.String())
+		}
+	}
+
+	if len(badNames) != 0 {
+		msg = "Subject Alt Name contains name"
+		if len(badNames) != 1 {
+			msg += "s"
+		}
+		msg += fmt.Sprintf(" not in Node %q addresses: ", nodeName)
+		msg += strings.Join(badNames, ",")
+		return msg, nil
+	}
+
+	return "", nil
+}
+
+func hasAddress(node *v1.Node, dnsName string) bool {
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case v1.NodeHostName, v1.NodeInternalDNS, v1.NodeExternalDNS:
+			if strings.EqualFold(address.Address, dnsName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasIp(node *v1.Node, ip net.IP) bool {
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case v1.NodeInternalIP, v1.NodeExternalIP:
+			if ip.Equal(net.ParseIP(address.Address)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package kubeletserving_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"net"
+	"net/url"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/kubeletserving"
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("kubeletserving")
+	require.True(t, exists, "inspectors.Get(\"kubeletserving\") to exist")
+
+	_, err := inspector.Configure("something")
+	assert.EqualError(t, err, "configuration not supported")
+}
+
+func TestInspect(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	for _, testcase := range []struct {
+		name          string
+		expectMessage string
+		username      string
+		groups        []string
+		usages        []certificates.KeyUsage
+		objects       []runtime.Object
+		setupRequest  func(request *x509.CertificateRequest)
+	}{
+		{
+			name: "Good",
+		},
+		{
+			name: "GoodServerAuthOnly",
+			usages: []certificates.KeyUsage{
+				certificates.UsageServerAuth,
+			},
+		},
+		{
+			name:          "NotNode",
+			username:      "system:serviceaccount:kube-system:somenode",
+			expectMessage: "Requesting user \"system:serviceaccount:kube-system:somenode\" is not a node",
+		},
+		{
+			name:          "EmptyNodeName",
+			username:      "system:node:",
+			expectMessage: "Requesting user \"system:node:\" is not a node",
+		},
+		{
+			name:          "NotInGroup",
+			groups:        []string{"system:authenticated"},
+			expectMessage: "Requesting user is not in the system:nodes group",
+		},
+		{
+			name: "ClientAuth",
+			usages: []certificates.KeyUsage{
+				certificates.UsageDigitalSignature,
+				certificates.UsageKeyEncipherment,
+				certificates.UsageServerAuth,
+				certificates.UsageClientAuth,
+			},
+			expectMessage: "Contains key usage client auth",
+		},
+		{
+			name: "NoServerAuth",
+			usages: []certificates.KeyUsage{
+				certificates.UsageDigitalSignature,
+			},
+			expectMessage: "Does not contain key usage server auth",
+		},
+		{
+			name: "WrongCN",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "system:node:othernode"
+			},
+			expectMessage: "Subject common name \"system:node:othernode\" is not \"system:node:somenode\"",
+		},
+		{
+			name: "NoOrganization",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.Organization = nil
+			},
+			expectMessage: "Subject organization [] is not [system:nodes]",
+		},
+		{
+			name: "ExtraOrganization",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.Organization = []string{"system:nodes", "system:masters"}
+			},
+			expectMessage: "Subject organization [\"system:nodes\" \"system:masters\"] is not [system:nodes]",
+		},
+		{
+			name: "ExtraSubjectComponent",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.OrganizationalUnit = []string{"someunit"}
+			},
+			expectMessage: "Subject has name components other than CN and O",
+		},
+		{
+			name: "EmailAddress",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.EmailAddresses = []string{"somenode@example.invalid"}
+			},
+			expectMessage: "Subject Alt Name contains names other than DNS names and IPs",
+		},
+		{
+			name: "Uri",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.invalid"}}
+			},
+			expectMessage: "Subject Alt Name contains names other than DNS names and IPs",
+		},
+		{
+			name: "OtherName",
+			setupRequest: func(request *x509.CertificateRequest) {
+				// A DNS name followed by a UPN otherName, which Go's CSR parser ignores.
+				request.ExtraExtensions = []pkix.Extension{{
+					Id: []int{2, 5, 29, 17},
+					Value: []byte{0x30, 0x1d,
+						0x82, 0x08, 's', 'o', 'm', 'e', 'n', 'o', 'd', 'e',
+						0xa0, 0x11, 0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x14, 0x02, 0x03, 0xa0, 0x03, 0x0c, 0x01, 'a'},
+				}}
+			},
+			expectMessage: "Subject Alt Name contains names other than DNS names and IPs",
+		},
+		{
+			name: "NoAltNames",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = nil
+				request.IPAddresses = nil
+			},
+			expectMessage: "Subject Alt Name contains no DNS names or IPs",
+		},
+		{
+			name:          "NoNode",
+			objects:       []runtime.Object{},
+			expectMessage: "No Node named \"somenode\"",
+		},
+		{
+			name: "DisallowedNames",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = append(request.DNSNames, "othernode.example.invalid")
+				request.IPAddresses = append(request.IPAddresses, net.ParseIP("10.0.0.2"))
+			},
+			expectMessage: "Subject Alt Name contains names not in Node \"somenode\" addresses: othernode.example.invalid,10.0.0.2",
+		},
+		{
+			name: "DnsNameFromIpAddress",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.DNSNames = []string{"10.0.0.1"}
+			},
+			expectMessage: "Subject Alt Name contains name not in Node \"somenode\" addresses: 10.0.0.1",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("kubeletserving")
+			require.True(t, exists, "inspectors.Get(\"kubeletserving\") to exist")
+
+			if testcase.objects == nil {
+				testcase.objects = []runtime.Object{
+					&v1.Node{
+						ObjectMeta: metaV1.ObjectMeta{
+							Name: "somenode",
+						},
+						Status: v1.NodeStatus{
+							Addresses: []v1.NodeAddress{
+								{Type: v1.NodeHostName, Address: "somenode"},
+								{Type: v1.NodeInternalDNS, Address: "somenode.internal.example.invalid"},
+								{Type: v1.NodeExternalDNS, Address: "somenode.example.invalid"},
+								{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+								{Type: v1.NodeExternalIP, Address: "192.0.2.1"},
+							},
+						},
+					},
+				}
+			}
+			client := fake.NewSimpleClientset(testcase.objects...)
+
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName:   "system:node:somenode",
+					Organization: []string{"system:nodes"},
+				},
+				SignatureAlgorithm: x509.ECDSAWithSHA256,
+				DNSNames:           []string{"somenode", "somenode.internal.example.invalid", "SomeNode.example.invalid"},
+				IPAddresses:        []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")},
+			}
+			if testcase.setupRequest != nil {
+				testcase.setupRequest(&certificateRequestTemplate)
+			}
+
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: testcase.username,
+					Groups:   testcase.groups,
+					Usages:   testcase.usages,
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+			if request.Spec.Username == "" {
+				request.Spec.Username = "system:node:somenode"
+			}
+			if request.Spec.Groups == nil {
+				request.Spec.Groups = []string{"system:nodes", "system:authenticated"}
+			}
+			if request.Spec.Usages == nil {
+				request.Spec.Usages = []certificates.KeyUsage{
+					certificates.UsageDigitalSignature,
+					certificates.UsageKeyEncipherment,
+					certificates.UsageServerAuth,
+				}
+			}
+
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -17,7 +17,7 @@ func init() {
 
 // Minkeysize is an Inspector that verifies that the CSR either has a non-RSA public key or has an
 // RSA public key of at least a configured minimum size. If you want to restrict public keys, use
-// the signaturealgorithm Inspector.
+// the publickey or signaturealgorithm Inspectors.
 type minrsakeysize struct {
 	minSize int
 }
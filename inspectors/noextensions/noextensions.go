@@ -14,6 +14,8 @@ func init() {
 
 // Noextensions is an Inspector that verifies that the CSR has no X.509 extensions
 // other than SubjectAltName
+//
+// Deprecated: use the extensions inspector, which by default behaves the same.
 type noextensions struct {
 }
 
@@ -0,0 +1,172 @@
+package publickey
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("publickey", &publickey{
+		permittedTypes: map[x509.PublicKeyAlgorithm]bool{
+			x509.RSA:     true,
+			x509.ECDSA:   true,
+			x509.Ed25519: true,
+		},
+		rsaMinBits:            defaultRsaMinBits,
+		rsaMaxBits:            defaultRsaMaxBits,
+		rsaPermittedExponents: map[int]bool{65537: true},
+		permittedCurves: map[string]bool{
+			"P-256": true,
+			"P-384": true,
+			"P-521": true,
+		},
+	})
+}
+
+// Publickey is an Inspector that verifies the CSR's public key is of a permitted type and meets
+// that type's requirements: an RSA key must have a modulus within the configured size range and a
+// permitted public exponent, and an ECDSA key must be on a permitted curve.
+type publickey struct {
+	permittedTypes        map[x509.PublicKeyAlgorithm]bool
+	rsaMinBits            int
+	rsaMaxBits            int
+	rsaPermittedExponents map[int]bool
+	permittedCurves       map[string]bool
+}
+
+const (
+	defaultRsaMinBits = 2048
+	defaultRsaMaxBits = 8192
+)
+
+var supportedTypes = map[string]x509.PublicKeyAlgorithm{
+	"rsa":     x509.RSA,
+	"ecdsa":   x509.ECDSA,
+	"ed25519": x509.Ed25519,
+}
+
+var supportedCurves = map[string]elliptic.Curve{
+	"p-224": elliptic.P224(),
+	"p-256": elliptic.P256(),
+	"p-384": elliptic.P384(),
+	"p-521": elliptic.P521(),
+}
+
+func (p *publickey) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return p, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := publickey{
+		rsaMinBits: defaultRsaMinBits,
+		rsaMaxBits: defaultRsaMaxBits,
+	}
+	for _, option := range options {
+		switch option.Key {
+		case "type":
+			keyType, ok := supportedTypes[strings.ToLower(option.Value)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported key type %s", option.Value)
+			}
+			if ret.permittedTypes == nil {
+				ret.permittedTypes = map[x509.PublicKeyAlgorithm]bool{}
+			}
+			ret.permittedTypes[keyType] = true
+		case "rsaminbits":
+			ret.rsaMinBits, err = strconv.Atoi(option.Value)
+			if err != nil || ret.rsaMinBits < 0 {
+				return nil, fmt.Errorf("invalid rsaminbits %q", option.Value)
+			}
+		case "rsamaxbits":
+			ret.rsaMaxBits, err = strconv.Atoi(option.Value)
+			if err != nil || ret.rsaMaxBits < 0 {
+				return nil, fmt.Errorf("invalid rsamaxbits %q", option.Value)
+			}
+		case "rsaexponent":
+			exponent, err := strconv.Atoi(option.Value)
+			if err != nil || exponent < 3 || exponent%2 == 0 {
+				return nil, fmt.Errorf("invalid rsaexponent %q", option.Value)
+			}
+			if ret.rsaPermittedExponents == nil {
+				ret.rsaPermittedExponents = map[int]bool{}
+			}
+			ret.rsaPermittedExponents[exponent] = true
+		case "curve":
+			curve, ok := supportedCurves[strings.ToLower(option.Value)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported curve %s", option.Value)
+			}
+			if ret.permittedCurves == nil {
+				ret.permittedCurves = map[string]bool{}
+			}
+			ret.permittedCurves[curve.Params().Name] = true
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+	}
+
+	if ret.rsaMaxBits < ret.rsaMinBits {
+		return nil, fmt.Errorf("rsamaxbits %d is less than rsaminbits %d", ret.rsaMaxBits, ret.rsaMinBits)
+	}
+	if ret.permittedTypes == nil {
+		ret.permittedTypes = p.permittedTypes
+	}
+	if ret.rsaPermittedExponents == nil {
+		ret.rsaPermittedExponents = p.rsaPermittedExponents
+	}
+	if ret.permittedCurves == nil {
+		ret.permittedCurves = p.permittedCurves
+	}
+
+	return &ret, nil
+}
+
+func (p *publickey) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	if !p.permittedTypes[certificateRequest.PublicKeyAlgorithm] {
+		return fmt.Sprintf("Public key type %s is not permitted", certificateRequest.PublicKeyAlgorithm), nil
+	}
+
+	switch key := certificateRequest.PublicKey.(type) {
+	case *rsa.PublicKey:
+		bitsize := key.N.BitLen()
+		if bitsize < p.rsaMinBits {
+			return fmt.Sprintf("RSA public key too small: %d < %d", bitsize, p.rsaMinBits), nil
+		}
+		if bitsize > p.rsaMaxBits {
+			return fmt.Sprintf("RSA public key too large: %d > %d", bitsize, p.rsaMaxBits), nil
+		}
+		if !p.rsaPermittedExponents[key.E] {
+			return fmt.Sprintf("RSA public exponent %d is not permitted", key.E), nil
+		}
+	case *ecdsa.PublicKey:
+		name := key.Curve.Params().Name
+		if !p.permittedCurves[name] {
+			return fmt.Sprintf("ECDSA curve %s is not permitted", name), nil
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Sprintf("Public key type %s is not supported", certificateRequest.PublicKeyAlgorithm), nil
+	}
+
+	return "", nil
+}
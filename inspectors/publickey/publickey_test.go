@@ -0,0 +1,195 @@
+package publickey_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"math/big"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/publickey"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("publickey")
+	require.True(t, exists, "inspectors.Get(\"publickey\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"type=dsa":                        "unsupported key type dsa",
+		"curve=P-192":                     "unsupported curve P-192",
+		"rsaminbits=big":                  "invalid rsaminbits \"big\"",
+		"rsamaxbits=-1":                   "invalid rsamaxbits \"-1\"",
+		"rsaminbits=4096,rsamaxbits=3072": "rsamaxbits 3072 is less than rsaminbits 4096",
+		"rsaexponent=1":                   "invalid rsaexponent \"1\"",
+		"rsaexponent=65536":               "invalid rsaexponent \"65536\"",
+		"other=value":                     "unsupported option \"other\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err, "Generate the private key")
+	rsaExponent3 := generateRsaKey(t, 2048, 3)
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	for _, testcase := range []struct {
+		name            string
+		inspectorConfig string
+		key             crypto.Signer
+		expectMessage   string
+	}{
+		{name: "DefaultRsa", key: rsa2048},
+		{name: "DefaultRsaTooSmall", key: rsa1024, expectMessage: "RSA public key too small: 1024 < 2048"},
+		{name: "DefaultRsaExponent", key: rsaExponent3, expectMessage: "RSA public exponent 3 is not permitted"},
+		{name: "DefaultP224", key: p224, expectMessage: "ECDSA curve P-224 is not permitted"},
+		{name: "DefaultP256", key: p256},
+		{name: "DefaultP384", key: p384},
+		{name: "DefaultEd25519", key: ed25519Key},
+		{
+			name:            "ConfiguredTypeEcdsa",
+			inspectorConfig: "type=ECDSA",
+			key:             p256,
+		},
+		{
+			name:            "ConfiguredTypeRsa",
+			inspectorConfig: "type=ECDSA",
+			key:             rsa2048,
+			expectMessage:   "Public key type RSA is not permitted",
+		},
+		{
+			name:            "ConfiguredTypeEd25519",
+			inspectorConfig: "type=rsa,type=ecdsa",
+			key:             ed25519Key,
+			expectMessage:   "Public key type Ed25519 is not permitted",
+		},
+		{
+			name:            "ConfiguredRsaMinBits",
+			inspectorConfig: "rsaminbits=1024",
+			key:             rsa1024,
+		},
+		{
+			name:            "ConfiguredRsaMinBitsTooSmall",
+			inspectorConfig: "rsaminbits=3072",
+			key:             rsa2048,
+			expectMessage:   "RSA public key too small: 2048 < 3072",
+		},
+		{
+			name:            "ConfiguredRsaMaxBitsTooLarge",
+			inspectorConfig: "rsaminbits=1024,rsamaxbits=1024",
+			key:             rsa2048,
+			expectMessage:   "RSA public key too large: 2048 > 1024",
+		},
+		{
+			name:            "ConfiguredRsaExponent",
+			inspectorConfig: "rsaexponent=3,rsaexponent=65537",
+			key:             rsaExponent3,
+		},
+		{
+			name:            "ConfiguredRsaExponentNotPermitted",
+			inspectorConfig: "rsaexponent=3",
+			key:             rsa2048,
+			expectMessage:   "RSA public exponent 65537 is not permitted",
+		},
+		{
+			name:            "ConfiguredCurve",
+			inspectorConfig: "curve=p-224",
+			key:             p224,
+		},
+		{
+			name:            "ConfiguredCurveNotPermitted",
+			inspectorConfig: "curve=P-256",
+			key:             p384,
+			expectMessage:   "ECDSA curve P-384 is not permitted",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("publickey")
+			require.True(t, exists, "inspectors.Get(\"publickey\") to exist")
+
+			if testcase.inspectorConfig != "" {
+				var err error
+				inspector, err = inspector.Configure(testcase.inspectorConfig)
+				require.NoError(t, err, "Configure")
+			}
+
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "example.invalid",
+				},
+			}
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, testcase.key)
+			require.NoError(t, err, "Generate the CSR")
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: "someRandomUser",
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// generateRsaKey generates an RSA key with a specific public exponent, which rsa.GenerateKey does not support.
+func generateRsaKey(t *testing.T, bits int, exponent int) *rsa.PrivateKey {
+	e := big.NewInt(int64(exponent))
+	one := big.NewInt(1)
+	for {
+		p, err := rand.Prime(rand.Reader, bits/2)
+		require.NoError(t, err, "Generate prime")
+		q, err := rand.Prime(rand.Reader, bits/2)
+		require.NoError(t, err, "Generate prime")
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		n := new(big.Int).Mul(p, q)
+		if n.BitLen() != bits {
+			continue
+		}
+		totient := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, totient)
+		if d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: exponent},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		require.NoError(t, key.Validate(), "Validate the private key")
+		return key
+	}
+}
@@ -12,18 +12,17 @@ import (
 )
 
 func init() {
-	inspectors.Register("signaturealgorithm", &signaturealgorithm{map[x509.SignatureAlgorithm]bool{
-		x509.SHA256WithRSA:    true,
-		x509.SHA384WithRSA:    true,
-		x509.SHA512WithRSA:    true,
-		x509.SHA256WithRSAPSS: true,
-		x509.SHA384WithRSAPSS: true,
-		x509.SHA512WithRSAPSS: true,
-	}})
+	permittedAlgorithms := map[x509.SignatureAlgorithm]bool{}
+	for _, algorithm := range presets["modern"] {
+		permittedAlgorithms[algorithm] = true
+	}
+	inspectors.Register("signaturealgorithm", &signaturealgorithm{permittedAlgorithms})
 }
 
-// SignatureAlgorithm is an Inspector that verifies that the CSR's signature algorithm is in a permitted set.
-// As the signature algorithm constrains the key type, it also verifies the public key type is in a permitted set.
+// SignatureAlgorithm is an Inspector that verifies that the CSR's signature algorithm is in a permitted set,
+// by default the modern preset.
+// As the signature algorithm constrains the key type, it also verifies the public key type is in a permitted set,
+// rejecting requests whose signature algorithm is inconsistent with their public key type.
 type signaturealgorithm struct {
 	permittedAlgorithms map[x509.SignatureAlgorithm]bool
 }
@@ -42,12 +41,48 @@ var supportedAlgorithms = map[string]x509.SignatureAlgorithm{
 	"sha256withrsapss": x509.SHA256WithRSAPSS,
 	"sha384withrsapss": x509.SHA384WithRSAPSS,
 	"sha512withrsapss": x509.SHA512WithRSAPSS,
+	"pureed25519":      x509.PureEd25519,
+	"ed25519":          x509.PureEd25519,
+}
+
+// Named sets of algorithms that may be used in place of, or in addition to, individual algorithms.
+var presets = map[string][]x509.SignatureAlgorithm{
+	"modern": {
+		x509.SHA256WithRSA,
+		x509.SHA384WithRSA,
+		x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS,
+		x509.SHA384WithRSAPSS,
+		x509.SHA512WithRSAPSS,
+		x509.ECDSAWithSHA256,
+		x509.ECDSAWithSHA384,
+		x509.ECDSAWithSHA512,
+		x509.PureEd25519,
+	},
+	// Algorithms approved by FIPS 186-4.
+	"fips": {
+		x509.SHA256WithRSA,
+		x509.SHA384WithRSA,
+		x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS,
+		x509.SHA384WithRSAPSS,
+		x509.SHA512WithRSAPSS,
+		x509.ECDSAWithSHA256,
+		x509.ECDSAWithSHA384,
+		x509.ECDSAWithSHA512,
+	},
 }
 
 func (s *signaturealgorithm) Configure(config string) (inspectors.Inspector, error) {
 	if config != "" {
 		ret := signaturealgorithm{permittedAlgorithms: map[x509.SignatureAlgorithm]bool{}}
 		for _, signatureAlgorithm := range strings.Split(config, ",") {
+			if preset, ok := presets[strings.ToLower(signatureAlgorithm)]; ok {
+				for _, algorithm := range preset {
+					ret.permittedAlgorithms[algorithm] = true
+				}
+				continue
+			}
 			algorithm, ok := supportedAlgorithms[strings.ToLower(signatureAlgorithm)]
 			if !ok {
 				return nil, errors.New(fmt.Sprintf("unsupported SignatureAlgorithm %s", signatureAlgorithm))
@@ -2,11 +2,13 @@ package signaturealgorithm_test
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"github.com/proofpoint/kapprover/inspectors"
@@ -14,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 	certificates "k8s.io/api/certificates/v1beta1"
 	"k8s.io/client-go/kubernetes"
+	"strings"
 	"testing"
 
 	_ "github.com/proofpoint/kapprover/inspectors/signaturealgorithm"
@@ -45,9 +48,10 @@ func TestInspect(t *testing.T) {
 		// { x509.DSAWithSHA1, x509.DSA, false },
 		// { x509.DSAWithSHA256, x509.DSA, false },
 		{x509.ECDSAWithSHA1, x509.ECDSA, false},
-		{x509.ECDSAWithSHA256, x509.ECDSA, false},
-		{x509.ECDSAWithSHA384, x509.ECDSA, false},
-		{x509.ECDSAWithSHA512, x509.ECDSA, false},
+		{x509.ECDSAWithSHA256, x509.ECDSA, true},
+		{x509.ECDSAWithSHA384, x509.ECDSA, true},
+		{x509.ECDSAWithSHA512, x509.ECDSA, true},
+		{x509.PureEd25519, x509.Ed25519, true},
 	} {
 		assertInspectionResult(t, inspector, testcase.signatureAlgorithm, testcase.publicKeyAlgorithm, testcase.expectAllow)
 	}
@@ -80,11 +84,133 @@ func TestInspectConfigured(t *testing.T) {
 		{x509.ECDSAWithSHA256, x509.ECDSA, true},
 		{x509.ECDSAWithSHA384, x509.ECDSA, true},
 		{x509.ECDSAWithSHA512, x509.ECDSA, true},
+		{x509.PureEd25519, x509.Ed25519, false},
 	} {
 		assertInspectionResult(t, inspector, testcase.signatureAlgorithm, testcase.publicKeyAlgorithm, testcase.expectAllow)
 	}
 }
 
+func TestInspectConfiguredEd25519(t *testing.T) {
+	for _, config := range []string{"Ed25519", "PureEd25519"} {
+		t.Run(config, func(t *testing.T) {
+			inspector, exists := inspectors.Get("signaturealgorithm")
+			require.True(t, exists, "inspectors.Get(\"signaturealgorithm\") to exist")
+
+			inspector, err := inspector.Configure(config)
+			assert.NoError(t, err, "Configure")
+
+			assertInspectionResult(t, inspector, x509.PureEd25519, x509.Ed25519, true)
+			assertInspectionResult(t, inspector, x509.ECDSAWithSHA256, x509.ECDSA, false)
+		})
+	}
+}
+
+func TestInspectPresets(t *testing.T) {
+	for _, testcase := range []struct {
+		config      string
+		expectAllow map[x509.SignatureAlgorithm]bool
+	}{
+		{
+			config: "modern",
+			expectAllow: map[x509.SignatureAlgorithm]bool{
+				x509.SHA1WithRSA:      false,
+				x509.SHA256WithRSA:    true,
+				x509.SHA512WithRSAPSS: true,
+				x509.ECDSAWithSHA1:    false,
+				x509.ECDSAWithSHA256:  true,
+				x509.ECDSAWithSHA384:  true,
+				x509.PureEd25519:      true,
+			},
+		},
+		{
+			config: "FIPS",
+			expectAllow: map[x509.SignatureAlgorithm]bool{
+				x509.SHA1WithRSA:      false,
+				x509.SHA256WithRSA:    true,
+				x509.SHA512WithRSAPSS: true,
+				x509.ECDSAWithSHA1:    false,
+				x509.ECDSAWithSHA256:  true,
+				x509.ECDSAWithSHA384:  true,
+				x509.PureEd25519:      false,
+			},
+		},
+		{
+			config: "fips,Ed25519,SHA1WithRSA",
+			expectAllow: map[x509.SignatureAlgorithm]bool{
+				x509.SHA1WithRSA:     true,
+				x509.SHA256WithRSA:   true,
+				x509.ECDSAWithSHA1:   false,
+				x509.ECDSAWithSHA256: true,
+				x509.PureEd25519:     true,
+			},
+		},
+	} {
+		t.Run(testcase.config, func(t *testing.T) {
+			inspector, exists := inspectors.Get("signaturealgorithm")
+			require.True(t, exists, "inspectors.Get(\"signaturealgorithm\") to exist")
+
+			inspector, err := inspector.Configure(testcase.config)
+			assert.NoError(t, err, "Configure")
+
+			for signatureAlgorithm, expectAllow := range testcase.expectAllow {
+				publicKeyAlgorithm := x509.RSA
+				switch signatureAlgorithm {
+				case x509.ECDSAWithSHA1, x509.ECDSAWithSHA256, x509.ECDSAWithSHA384:
+					publicKeyAlgorithm = x509.ECDSA
+				case x509.PureEd25519:
+					publicKeyAlgorithm = x509.Ed25519
+				}
+				assertInspectionResult(t, inspector, signatureAlgorithm, publicKeyAlgorithm, expectAllow)
+			}
+		})
+	}
+}
+
+func TestInspectInconsistentPublicKey(t *testing.T) {
+	inspector, exists := inspectors.Get("signaturealgorithm")
+	require.True(t, exists, "inspectors.Get(\"signaturealgorithm\") to exist")
+
+	inspector, err := inspector.Configure("modern")
+	assert.NoError(t, err, "Configure")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	// Relabel the signature as SHA256WithRSA.
+	var raw struct {
+		TBSCSR             asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}
+	_, err = asn1.Unmarshal(certificateRequest, &raw)
+	require.NoError(t, err, "Unmarshal the CSR")
+	raw.SignatureAlgorithm = pkix.AlgorithmIdentifier{
+		Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11},
+		Parameters: asn1.NullRawValue,
+	}
+	certificateRequest, err = asn1.Marshal(raw)
+	require.NoError(t, err, "Marshal the CSR")
+
+	request := certificates.CertificateSigningRequest{
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: "someRandomUser",
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+		},
+	}
+	message, err := inspector.Inspect(client, &request)
+	assert.Equal(t, "SignatureAlgorithm SHA256-RSA is inconsistent with public key type ECDSA", message)
+	assert.NoError(t, err)
+}
+
 func TestConfigureBadAlgorithm(t *testing.T) {
 	for _, algorithm := range []string{
 		"MD2WithRSA",
@@ -110,9 +236,11 @@ func assertInspectionResult(t *testing.T, inspector inspectors.Inspector, signat
 		switch publicKeyAlgorithm {
 		case x509.RSA:
 			// Generate a private key.
-			key, err = rsa.GenerateKey(rand.Reader, 1024)
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
 		case x509.ECDSA:
 			key, err = ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		case x509.Ed25519:
+			_, key, err = ed25519.GenerateKey(rand.Reader)
 		default:
 			t.Error("Cannot test key algorithm type", publicKeyAlgorithm)
 			return
@@ -128,6 +256,10 @@ func assertInspectionResult(t *testing.T, inspector inspectors.Inspector, signat
 		}
 
 		certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+		if err != nil && strings.Contains(err.Error(), "is not supported") {
+			// Newer Go releases refuse to sign with MD5.
+			t.Skip(err)
+		}
 		require.NoError(t, err, "Generate the CSR")
 
 		certificateRequestBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest})
@@ -140,7 +272,10 @@ func assertInspectionResult(t *testing.T, inspector inspectors.Inspector, signat
 		}
 		message, err := inspector.Inspect(client, &request)
 		expectedMessage := ""
-		if !expectAllow {
+		if signatureAlgorithm == x509.MD5WithRSA {
+			// MD5 signatures cannot be verified, so parsing rejects them first.
+			expectedMessage = "Request had unsupported signature algorithm MD5-RSA"
+		} else if !expectAllow {
 			expectedMessage = fmt.Sprintf("SignatureAlgorithm is %s", signatureAlgorithm)
 		}
 		assert.Equal(t, expectedMessage, message, "SignatureAlgorithm %s", signatureAlgorithm)
@@ -0,0 +1,30 @@
+package strictcsr
+
+import (
+	"errors"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	inspectors.Register("strictcsr", &strictcsr{})
+}
+
+// Strictcsr is an Inspector that verifies that the CSR is a single, header-free PEM block
+// of canonical DER with no attributes other than an extension request.
+type strictcsr struct {
+}
+
+func (s *strictcsr) Configure(config string) (inspectors.Inspector, error) {
+	if config != "" {
+		return nil, errors.New("configuration not supported")
+	}
+	return s, nil
+}
+
+func (s *strictcsr) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	_, msg := csr.ExtractStrict(request.Spec.Request)
+	return msg, nil
+}
@@ -0,0 +1,81 @@
+package strictcsr_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/strictcsr"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("strictcsr")
+	require.True(t, exists, "inspectors.Get(\"strictcsr\") to exist")
+
+	_, err := inspector.Configure("something")
+	assert.EqualError(t, err, "configuration not supported")
+}
+
+func TestInspect(t *testing.T) {
+	inspector, exists := inspectors.Get("strictcsr")
+	require.True(t, exists, "inspectors.Get(\"strictcsr\") to exist")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	for _, testcase := range []struct {
+		name          string
+		block         pem.Block
+		prefix        string
+		expectMessage string
+	}{
+		{
+			name:  "Good",
+			block: pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest},
+		},
+		{
+			name:          "TextBefore",
+			block:         pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest},
+			prefix:        "Subject: CN=example.invalid\n",
+			expectMessage: "Request had text before the PEM object",
+		},
+		{
+			name:          "WrongType",
+			block:         pem.Block{Type: "NEW CERTIFICATE REQUEST", Bytes: certificateRequest},
+			expectMessage: "Request had PEM object of type \"NEW CERTIFICATE REQUEST\"",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: "someRandomUser",
+					Request:  append([]byte(testcase.prefix), pem.EncodeToMemory(&testcase.block)...),
+				},
+			}
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err, "Error")
+		})
+	}
+}
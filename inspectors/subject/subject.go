@@ -0,0 +1,269 @@
+package subject
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("subject", &subject{map[string]*rule{
+		"CN": {required: true},
+	}})
+}
+
+// Subject is an Inspector that verifies each attribute of the CSR's subject is permitted, appears
+// at most once, is encoded as a UTF8String or PrintableString and matches its configured pattern,
+// and that all required attributes are present. Patterns may refer to the requester's identity.
+type subject struct {
+	rules map[string]*rule
+}
+
+type rule struct {
+	required   bool
+	hasPattern bool
+	pattern    string
+	parts      []patternPart
+}
+
+// patternPart is a literal string, a "*" wildcard or a "{variable}" reference.
+type patternPart struct {
+	literal  string
+	wildcard bool
+	variable string
+}
+
+// identity holds the values available to patterns.
+type identity map[string]string
+
+var supportedAttributes = map[string]string{
+	"2.5.4.3":  "CN",
+	"2.5.4.5":  "SERIALNUMBER",
+	"2.5.4.6":  "C",
+	"2.5.4.7":  "L",
+	"2.5.4.8":  "ST",
+	"2.5.4.9":  "STREET",
+	"2.5.4.10": "O",
+	"2.5.4.11": "OU",
+	"2.5.4.17": "POSTALCODE",
+}
+
+var supportedVariables = map[string]bool{
+	"namespace":      true,
+	"serviceaccount": true,
+	"username":       true,
+}
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type relativeDistinguishedNameSET []attribute
+
+func (s *subject) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return s, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := subject{rules: map[string]*rule{}}
+	for _, option := range options {
+		var required bool
+		switch option.Key {
+		case "allow":
+		case "require":
+			required = true
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+
+		name := option.Value
+		pattern := ""
+		hasPattern := false
+		if i := strings.Index(name, "="); i != -1 {
+			name, pattern, hasPattern = name[:i], name[i+1:], true
+		}
+		name = strings.ToUpper(name)
+		if !isSupportedAttribute(name) {
+			return nil, fmt.Errorf("unsupported attribute %q", name)
+		}
+		if _, ok := ret.rules[name]; ok {
+			return nil, fmt.Errorf("attribute %s configured more than once", name)
+		}
+
+		r := rule{required: required, hasPattern: hasPattern, pattern: pattern}
+		if hasPattern {
+			r.parts, err = compilePattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ret.rules[name] = &r
+	}
+
+	return &ret, nil
+}
+
+func isSupportedAttribute(name string) bool {
+	for _, supported := range supportedAttributes {
+		if supported == name {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePattern(pattern string) ([]patternPart, error) {
+	var parts []patternPart
+	literal := ""
+	for rest := pattern; rest != ""; {
+		switch rest[0] {
+		case '*':
+			parts = appendLiteral(parts, literal)
+			literal = ""
+			parts = append(parts, patternPart{wildcard: true})
+			rest = rest[1:]
+		case '{':
+			end := strings.Index(rest, "}")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated variable in pattern %q", pattern)
+			}
+			variable := strings.ToLower(rest[1:end])
+			if !supportedVariables[variable] {
+				return nil, fmt.Errorf("unsupported variable %q in pattern %q", rest[1:end], pattern)
+			}
+			parts = appendLiteral(parts, literal)
+			literal = ""
+			parts = append(parts, patternPart{variable: variable})
+			rest = rest[end+1:]
+		default:
+			literal += rest[:1]
+			rest = rest[1:]
+		}
+	}
+	return appendLiteral(parts, literal), nil
+}
+
+func appendLiteral(parts []patternPart, literal string) []patternPart {
+	if literal == "" {
+		return parts
+	}
+	return append(parts, patternPart{literal: literal})
+}
+
+func (s *subject) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	var rdnSequence []relativeDistinguishedNameSET
+	if rest, err := asn1.Unmarshal(certificateRequest.RawSubject, &rdnSequence); err != nil || len(rest) != 0 {
+		return "Subject is not a valid distinguished name", nil
+	}
+
+	id := newIdentity(request.Spec.Username)
+	seen := map[string]bool{}
+	for _, rdn := range rdnSequence {
+		for _, attribute := range rdn {
+			name, ok := supportedAttributes[attribute.Type.String()]
+			if !ok {
+				return fmt.Sprintf("Subject has unsupported attribute %s", attribute.Type), nil
+			}
+			r, ok := s.rules[name]
+			if !ok {
+				return fmt.Sprintf("Subject attribute %s is not permitted", name), nil
+			}
+			if seen[name] {
+				return fmt.Sprintf("Subject has more than one %s", name), nil
+			}
+			seen[name] = true
+
+			value, msg := attributeValue(name, attribute.Value)
+			if msg != "" {
+				return msg, nil
+			}
+			if r.hasPattern {
+				matched, msg := r.matches(value, id)
+				if msg != "" {
+					return msg, nil
+				}
+				if !matched {
+					return fmt.Sprintf("Subject %s %q does not match %q", name, value, r.pattern), nil
+				}
+			}
+		}
+	}
+
+	for name, r := range s.rules {
+		if r.required && !seen[name] {
+			return fmt.Sprintf("Subject has no %s", name), nil
+		}
+	}
+
+	return "", nil
+}
+
+func attributeValue(name string, value asn1.RawValue) (string, string) {
+	if value.Class != asn1.ClassUniversal || (value.Tag != asn1.TagUTF8String && value.Tag != asn1.TagPrintableString) {
+		return "", fmt.Sprintf("Subject %s is not a UTF8String or PrintableString", name)
+	}
+
+	var s string
+	if _, err := asn1.Unmarshal(value.FullBytes, &s); err != nil {
+		return "", fmt.Sprintf("Subject %s is not a valid %s", name, stringTypeName(value.Tag))
+	}
+	return s, ""
+}
+
+func stringTypeName(tag int) string {
+	if tag == asn1.TagUTF8String {
+		return "UTF8String"
+	}
+	return "PrintableString"
+}
+
+func newIdentity(username string) identity {
+	id := identity{"username": username}
+	if strings.HasPrefix(username, serviceAccountPrefix) {
+		split := strings.Split(strings.TrimPrefix(username, serviceAccountPrefix), ":")
+		if len(split) == 2 {
+			id["namespace"] = split[0]
+			id["serviceaccount"] = split[1]
+		}
+	}
+	return id
+}
+
+// matches reports whether value matches the rule's pattern for the requester's identity, or
+// returns a message if the pattern refers to something the requester's identity does not have.
+func (r *rule) matches(value string, id identity) (bool, string) {
+	expression := "(?s)^"
+	for _, part := range r.parts {
+		switch {
+		case part.wildcard:
+			expression += ".*"
+		case part.variable != "":
+			variableValue, ok := id[part.variable]
+			if !ok {
+				return false, fmt.Sprintf("Requesting user %q is not a service account", id["username"])
+			}
+			expression += regexp.QuoteMeta(variableValue)
+		default:
+			expression += regexp.QuoteMeta(part.literal)
+		}
+	}
+	return regexp.MustCompile(expression + "$").MatchString(value), ""
+}
@@ -0,0 +1,185 @@
+package subject_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/subject"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+var (
+	oidCommonName         = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidOrganization       = asn1.ObjectIdentifier{2, 5, 4, 10}
+	oidOrganizationalUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+)
+
+const serviceAccountUser = "system:serviceaccount:somenamespace:someaccount"
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("subject")
+	require.True(t, exists, "inspectors.Get(\"subject\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"require=XX":                 "unsupported attribute \"XX\"",
+		"deny=CN":                    "unsupported option \"deny\"",
+		"require=CN,allow=cn=foo":    "attribute CN configured more than once",
+		"require=O={namespace":       "unterminated variable in pattern \"{namespace\"",
+		"require=O={nosuchvariable}": "unsupported variable \"nosuchvariable\" in pattern \"{nosuchvariable}\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	for _, testcase := range []struct {
+		name          string
+		config        string
+		username      string
+		subject       pkix.RDNSequence
+		expectMessage string
+	}{
+		{
+			name:    "DefaultCommonName",
+			subject: rdns(rdn(oidCommonName, "example.invalid")),
+		},
+		{
+			name:          "DefaultOrganization",
+			subject:       rdns(rdn(oidCommonName, "example.invalid"), rdn(oidOrganization, "someorg")),
+			expectMessage: "Subject attribute O is not permitted",
+		},
+		{
+			name:          "DefaultNoCommonName",
+			subject:       rdns(),
+			expectMessage: "Subject has no CN",
+		},
+		{
+			name:     "Templated",
+			config:   "require=CN=*.{namespace}.svc,require=O={namespace},allow=OU={serviceaccount}",
+			username: serviceAccountUser,
+			subject:  rdns(rdn(oidCommonName, "web.somenamespace.svc"), rdn(oidOrganization, "somenamespace"), rdn(oidOrganizationalUnit, "someaccount")),
+		},
+		{
+			name:     "TemplatedOptionalAbsent",
+			config:   "require=CN=*.{namespace}.svc,require=O={namespace},allow=OU={serviceaccount}",
+			username: serviceAccountUser,
+			subject:  rdns(rdn(oidCommonName, "web.somenamespace.svc"), rdn(oidOrganization, "somenamespace")),
+		},
+		{
+			name:          "TemplatedMismatch",
+			config:        "require=CN,require=O={namespace}",
+			username:      serviceAccountUser,
+			subject:       rdns(rdn(oidCommonName, "web"), rdn(oidOrganization, "othernamespace")),
+			expectMessage: "Subject O \"othernamespace\" does not match \"{namespace}\"",
+		},
+		{
+			name:          "TemplatedMetacharacters",
+			config:        "require=CN={username}",
+			username:      "a.b",
+			subject:       rdns(rdn(oidCommonName, "axb")),
+			expectMessage: "Subject CN \"axb\" does not match \"{username}\"",
+		},
+		{
+			name:          "TemplatedNotServiceAccount",
+			config:        "require=O={namespace}",
+			username:      "someRandomUser",
+			subject:       rdns(rdn(oidOrganization, "somenamespace")),
+			expectMessage: "Requesting user \"someRandomUser\" is not a service account",
+		},
+		{
+			name:          "EmptyPattern",
+			config:        "require=CN,allow=OU=",
+			subject:       rdns(rdn(oidCommonName, "web"), rdn(oidOrganizationalUnit, "someunit")),
+			expectMessage: "Subject OU \"someunit\" does not match \"\"",
+		},
+		{
+			name:    "EmptyPatternEmptyValue",
+			config:  "require=CN,allow=OU=",
+			subject: rdns(rdn(oidCommonName, "web"), rdn(oidOrganizationalUnit, "")),
+		},
+		{
+			name:          "MissingRequired",
+			config:        "require=CN,require=O",
+			subject:       rdns(rdn(oidCommonName, "web")),
+			expectMessage: "Subject has no O",
+		},
+		{
+			name:          "Duplicate",
+			config:        "require=CN,allow=OU",
+			subject:       rdns(rdn(oidCommonName, "web"), rdn(oidOrganizationalUnit, "one"), rdn(oidOrganizationalUnit, "two")),
+			expectMessage: "Subject has more than one OU",
+		},
+		{
+			name:          "Unknown",
+			config:        "require=CN",
+			subject:       rdns(rdn(oidCommonName, "web"), rdn(asn1.ObjectIdentifier{1, 2, 3, 4}, "value")),
+			expectMessage: "Subject has unsupported attribute 1.2.3.4",
+		},
+		{
+			name:    "UTF8String",
+			config:  "require=CN=caf*",
+			subject: rdns(rdn(oidCommonName, "café")),
+		},
+		{
+			name:          "IA5String",
+			config:        "require=CN",
+			subject:       rdns(rdn(oidCommonName, asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte("web")})),
+			expectMessage: "Subject CN is not a UTF8String or PrintableString",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("subject")
+			require.True(t, exists, "inspectors.Get(\"subject\") to exist")
+			inspector, err := inspector.Configure(testcase.config)
+			require.NoError(t, err, "Configure")
+
+			rawSubject, err := asn1.Marshal(testcase.subject)
+			require.NoError(t, err, "Marshal the subject")
+			certificateRequestTemplate := x509.CertificateRequest{
+				RawSubject:         rawSubject,
+				SignatureAlgorithm: x509.SHA256WithRSA,
+			}
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+
+			username := testcase.username
+			if username == "" {
+				username = "someRandomUser"
+			}
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: username,
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err, "Error")
+		})
+	}
+}
+
+func rdns(rdns ...pkix.RelativeDistinguishedNameSET) pkix.RDNSequence {
+	return pkix.RDNSequence(rdns)
+}
+
+func rdn(oid asn1.ObjectIdentifier, value interface{}) pkix.RelativeDistinguishedNameSET {
+	return pkix.RelativeDistinguishedNameSET{{Type: oid, Value: value}}
+}
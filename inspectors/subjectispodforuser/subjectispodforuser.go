@@ -1,72 +1,82 @@
 package subjectispodforuser
 
 import (
-	"context"
 	"fmt"
+	"github.com/proofpoint/kapprover/clusterdomain"
 	"github.com/proofpoint/kapprover/csr"
 	"github.com/proofpoint/kapprover/inspectors"
-	"github.com/sirupsen/logrus"
+	"github.com/proofpoint/kapprover/podresolver"
 	certificates "k8s.io/api/certificates/v1beta1"
-	"k8s.io/api/core/v1"
-	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"strings"
 )
 
 func init() {
-	inspectors.Register("subjectispodforuser", &subjectispodforuser{"cluster.local"})
+	inspectors.Register("subjectispodforuser", &subjectispodforuser{})
 }
 
 // SubjectIsPodForUser is an Inspector that verifies the CSR contains a subject that contains only
-// the DNS name for a POD in a deployment that has the requesting username as the service account
+// the DNS name for a POD in a deployment that has the requesting username as the service account.
+// Unless configured with a cluster domain, it uses the global one. Unless configured with schemes by
+// which the request may name the POD, it must use the podip scheme.
 type subjectispodforuser struct {
 	clusterDomain string
+	resolvers     []podresolver.Resolver
 }
 
 func (s *subjectispodforuser) Configure(config string) (inspectors.Inspector, error) {
-	if config != "" {
-		return &subjectispodforuser{clusterDomain: config}, nil
+	if config == "" {
+		return s, nil
 	}
-	return s, nil
-}
-
-func (s *subjectispodforuser) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
-	certificateRequest, msg := csr.Extract(request.Spec.Request)
-	if msg != "" {
-		return msg, nil
-	}
-
-	podIp, namespace, msg := csr.GetPodIpAndNamespace(s.clusterDomain, certificateRequest)
-	if msg != "" {
-		return msg, nil
+	if !strings.ContainsAny(config, "=,") {
+		return &subjectispodforuser{clusterDomain: config}, nil
 	}
 
-	podList, err := client.CoreV1().Pods(namespace).List(context.TODO(), metaV1.ListOptions{FieldSelector: "status.podIP=" + podIp})
+	options, err := inspectors.ParseOptions(config)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	filtered := make([]v1.Pod, 0, 1)
-	for _, pod := range podList.Items {
-		if pod.DeletionTimestamp != nil {
-			continue
+	ret := subjectispodforuser{}
+	var schemes []string
+	for _, option := range options {
+		switch option.Key {
+		case "clusterdomain":
+			if option.Value == "" {
+				return nil, fmt.Errorf("invalid clusterdomain %q", option.Value)
+			}
+			ret.clusterDomain = option.Value
+		case "scheme":
+			schemes = append(schemes, option.Value)
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
 		}
-		if pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodRunning {
-			continue
+	}
+	if schemes != nil {
+		if ret.resolvers, err = podresolver.Lookup(schemes); err != nil {
+			return nil, err
 		}
-		filtered = append(filtered, pod)
 	}
 
-	if len(filtered) == 0 {
-		return fmt.Sprintf("No pending or running POD in namespace %q with IP %q", namespace, podIp), nil
+	return &ret, nil
+}
+
+func (s *subjectispodforuser) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
 	}
-	if len(filtered) > 1 {
-		logrus.Warnf("Subjectispodforuser found multiple pods for IP %q", podIp)
-		for _, pod := range filtered {
-			logrus.Infof("Pod %+v", pod)
-		}
+
+	clusterDomain := s.clusterDomain
+	if clusterDomain == "" {
+		clusterDomain = clusterdomain.Get()
+	}
+	pod, msg, err := podresolver.Resolve(s.resolvers, client, request, certificateRequest, append([]string{clusterDomain}, clusterdomain.Aliases()...))
+	if err != nil || msg != "" {
+		return msg, err
 	}
 
-	expectedServiceAccount := "system:serviceaccount:" + namespace + ":" + filtered[0].Spec.ServiceAccountName
+	expectedServiceAccount := "system:serviceaccount:" + pod.Namespace + ":" + pod.Spec.ServiceAccountName
 	if request.Spec.Username != expectedServiceAccount {
 		return fmt.Sprintf("Requesting user %q is not %q", request.Spec.Username, expectedServiceAccount), nil
 	}
@@ -1,6 +1,7 @@
 package subjectispodforuser_test
 
 import (
+	"github.com/proofpoint/kapprover/clusterdomain"
 	"github.com/proofpoint/kapprover/inspectors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,8 +18,23 @@ import (
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	"net"
 )
 
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("subjectispodforuser")
+	require.True(t, exists, "inspectors.Get(\"subjectispodforuser\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"clusterdomain=":              "invalid clusterdomain \"\"",
+		"scheme=podip,scheme=unknown": "unsupported scheme \"unknown\", registered schemes: hostname,podip,san",
+		"unknown=option":              "unsupported option \"unknown\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
 func TestInspect(t *testing.T) {
 	key, err := rsa.GenerateKey(rand.Reader, 1024)
 	require.NoError(t, err, "Generate the private key")
@@ -34,6 +50,8 @@ func TestInspect(t *testing.T) {
 		setupRequest    func(request *x509.CertificateRequest)
 		podNamespace    string
 		podIp           string
+		globalDomain    string
+		globalAliases   []string
 	}{
 		{
 			name:          "CnHasO",
@@ -123,9 +141,9 @@ func TestInspect(t *testing.T) {
 		},
 		{
 			name:          "IpMissingByte",
-			expectMessage: "Subject \"172--2-3.somenamespace.pod.cluster.local\" is not a POD-format name",
+			expectMessage: "Subject \"172-1-2-.somenamespace.pod.cluster.local\" is not a POD-format name",
 			setupRequest: func(request *x509.CertificateRequest) {
-				request.Subject.CommonName = "172--2-3.somenamespace.pod.cluster.local"
+				request.Subject.CommonName = "172-1-2-.somenamespace.pod.cluster.local"
 			},
 		},
 		// https://github.com/kubernetes/client-go/issues/326
@@ -249,6 +267,54 @@ func TestInspect(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "Ipv6",
+			podIp: "fd00:10:244::3",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "fd00-10-244--3.somenamespace.pod.cluster.local"
+			},
+		},
+		{
+			name: "DualStackSecondaryIp",
+			objects: []runtime.Object{&v1.Pod{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      "tls-app-579f7cd745-t6fdg",
+					Namespace: "somenamespace",
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "someserviceaccount",
+				},
+				Status: v1.PodStatus{
+					Phase:  v1.PodRunning,
+					PodIP:  "172.1.0.3",
+					PodIPs: []v1.PodIP{{IP: "172.1.0.3"}, {IP: "fd00:10:244::3"}},
+				},
+			}},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "fd00-10-244--3.somenamespace.pod.cluster.local"
+			},
+		},
+		{
+			name: "DualStackWrongIp",
+			objects: []runtime.Object{&v1.Pod{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      "tls-app-579f7cd745-t6fdg",
+					Namespace: "somenamespace",
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "someserviceaccount",
+				},
+				Status: v1.PodStatus{
+					Phase:  v1.PodRunning,
+					PodIP:  "172.1.0.3",
+					PodIPs: []v1.PodIP{{IP: "172.1.0.3"}, {IP: "fd00:10:244::3"}},
+				},
+			}},
+			expectMessage: "No pending or running POD in namespace \"somenamespace\" with IP \"fd00:10:244::4\"",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "fd00-10-244--4.somenamespace.pod.cluster.local"
+			},
+		},
 		{
 			name:            "ConfiguredNotInClusterDomain",
 			inspectorConfig: "example.com",
@@ -263,8 +329,98 @@ func TestInspect(t *testing.T) {
 				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.example.com"
 			},
 		},
+		{
+			name:         "GlobalClusterDomain",
+			globalDomain: "example.com",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.example.com"
+			},
+		},
+		{
+			name:          "GlobalClusterDomainNotInDomain",
+			globalDomain:  "example.com",
+			expectMessage: "Subject \"172-1-0-3.somenamespace.pod.cluster.local\" is not in the pod.example.com domain",
+		},
+		{
+			name:            "ConfiguredOverridesGlobal",
+			inspectorConfig: "cluster.local",
+			globalDomain:    "example.com",
+		},
+		{
+			name:          "GlobalAlias",
+			globalAliases: []string{"old.example.com"},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.old.example.com"
+			},
+		},
+		{
+			name:            "SchemeHostname",
+			inspectorConfig: "scheme=podip,scheme=hostname",
+			objects: []runtime.Object{&v1.Pod{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      "web-0",
+					Namespace: "somenamespace",
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "someserviceaccount",
+					Hostname:           "web-0",
+					Subdomain:          "web",
+				},
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					PodIP: "172.1.0.3",
+				},
+			}},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "web-0.web.somenamespace.svc.cluster.local"
+			},
+		},
+		{
+			name:          "HostnameWithoutScheme",
+			expectMessage: "Subject \"web-0.web.somenamespace.svc.cluster.local\" is not in the pod.cluster.local domain",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "web-0.web.somenamespace.svc.cluster.local"
+			},
+		},
+		{
+			name:            "SchemeSan",
+			inspectorConfig: "scheme=podip,scheme=san",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = ""
+				request.IPAddresses = []net.IP{net.ParseIP("172.1.0.3")}
+			},
+		},
+		{
+			name:            "SanWithOrganization",
+			inspectorConfig: "scheme=san",
+			expectMessage:   "Subject has a name component but no common name",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = ""
+				request.Subject.Organization = []string{"system:masters"}
+				request.IPAddresses = []net.IP{net.ParseIP("172.1.0.3")}
+			},
+		},
+		{
+			name:            "SchemeSanWrongUser",
+			inspectorConfig: "scheme=san",
+			serviceAccount:  "system:serviceaccount:somenamespace:otherserviceaccount",
+			expectMessage:   "Requesting user \"system:serviceaccount:somenamespace:otherserviceaccount\" is not \"system:serviceaccount:somenamespace:someserviceaccount\"",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = ""
+				request.DNSNames = []string{"172-1-0-3.somenamespace.pod.cluster.local"}
+			},
+		},
 	} {
 		t.Run(testcase.name, func(t *testing.T) {
+			if testcase.globalDomain != "" || testcase.globalAliases != nil {
+				domain := testcase.globalDomain
+				if domain == "" {
+					domain = clusterdomain.Default
+				}
+				clusterdomain.Set(domain, testcase.globalAliases)
+				defer clusterdomain.Set(clusterdomain.Default, nil)
+			}
+
 			inspector, exists := inspectors.Get("subjectispodforuser")
 			if !exists {
 				t.Fatal("Expected inspectors.Get(\"subjectispodforuser\") to exist, did not")
@@ -0,0 +1,110 @@
+package subjectisserviceforuser
+
+import (
+	"context"
+	"fmt"
+	"github.com/proofpoint/kapprover/clusterdomain"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/podnames"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+func init() {
+	inspectors.Register("subjectisserviceforuser", &subjectisserviceforuser{})
+}
+
+// SubjectIsServiceForUser is an Inspector that verifies the CSR contains a subject that contains
+// only the DNS name of a Service selecting at least one ready POD that has the requesting username
+// as the service account. Unless configured with a cluster domain, it uses the global one.
+type subjectisserviceforuser struct {
+	clusterDomain string
+}
+
+func (s *subjectisserviceforuser) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return s, nil
+	}
+	if !strings.ContainsAny(config, "=,") {
+		return &subjectisserviceforuser{clusterDomain: config}, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := subjectisserviceforuser{}
+	for _, option := range options {
+		switch option.Key {
+		case "clusterdomain":
+			if option.Value == "" {
+				return nil, fmt.Errorf("invalid clusterdomain %q", option.Value)
+			}
+			ret.clusterDomain = option.Value
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+	}
+
+	return &ret, nil
+}
+
+func (s *subjectisserviceforuser) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	if len(certificateRequest.Subject.Names) > 1 {
+		return "Subject has more than one name component", nil
+	}
+
+	clusterDomain := s.clusterDomain
+	if clusterDomain == "" {
+		clusterDomain = clusterdomain.Get()
+	}
+	subject := certificateRequest.Subject.CommonName
+	var labels []string
+	for _, domain := range append([]string{clusterDomain}, clusterdomain.Aliases()...) {
+		suffix := ".svc." + domain
+		if strings.HasSuffix(subject, suffix) {
+			labels = strings.Split(strings.TrimSuffix(subject, suffix), ".")
+			break
+		}
+	}
+	if labels == nil {
+		return fmt.Sprintf("Subject %q is not in the svc.%s domain", subject, clusterDomain), nil
+	}
+	if len(labels) != 2 || labels[0] == "" || labels[1] == "" {
+		return fmt.Sprintf("Subject %q is not a Service name", subject), nil
+	}
+	serviceName, namespace := labels[0], labels[1]
+
+	service, err := client.CoreV1().Services(namespace).Get(context.TODO(), serviceName, metaV1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("No Service %q in namespace %q", serviceName, namespace), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	pods, err := podnames.GetPodsForService(client, *service)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		if !podnames.IsReady(pod) {
+			continue
+		}
+		if request.Spec.Username == "system:serviceaccount:"+pod.Namespace+":"+pod.Spec.ServiceAccountName {
+			return "", nil
+		}
+	}
+
+	return fmt.Sprintf("Requesting user %q does not run a ready POD selected by Service %q in namespace %q", request.Spec.Username, serviceName, namespace), nil
+}
@@ -0,0 +1,288 @@
+package subjectisserviceforuser_test
+
+import (
+	"github.com/proofpoint/kapprover/clusterdomain"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	_ "github.com/proofpoint/kapprover/inspectors/subjectisserviceforuser"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("subjectisserviceforuser")
+	require.True(t, exists, "inspectors.Get(\"subjectisserviceforuser\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"clusterdomain=": "invalid clusterdomain \"\"",
+		"unknown=option": "unsupported option \"unknown\"",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err, "Generate the private key")
+
+	nowTime := metaV1.Now()
+
+	makePod := func(name, serviceAccount string, phase v1.PodPhase, ready bool) *v1.Pod {
+		readyStatus := v1.ConditionFalse
+		if ready {
+			readyStatus = v1.ConditionTrue
+		}
+		return &v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      name,
+				Namespace: "somenamespace",
+				Labels: map[string]string{
+					"app": "some-app",
+				},
+			},
+			Spec: v1.PodSpec{
+				ServiceAccountName: serviceAccount,
+			},
+			Status: v1.PodStatus{
+				Phase: phase,
+				Conditions: []v1.PodCondition{
+					{
+						Type:   v1.PodReady,
+						Status: readyStatus,
+					},
+				},
+			},
+		}
+	}
+	service := &v1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "tls-service",
+			Namespace: "somenamespace",
+		},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"app": "some-app"},
+		},
+	}
+	deletedPod := makePod("deleted", "someserviceaccount", v1.PodRunning, true)
+	deletedPod.DeletionTimestamp = &nowTime
+	otherLabelPod := makePod("other", "someserviceaccount", v1.PodRunning, true)
+	otherLabelPod.Labels["app"] = "other-app"
+
+	for _, testcase := range []struct {
+		name            string
+		inspectorConfig string
+		expectMessage   string
+		serviceAccount  string
+		objects         []runtime.Object
+		setupRequest    func(request *x509.CertificateRequest)
+		globalDomain    string
+		globalAliases   []string
+	}{
+		{
+			name: "Good",
+		},
+		{
+			name: "AnyOfTheServicesPods",
+			objects: []runtime.Object{
+				service,
+				makePod("pod-0", "otherserviceaccount", v1.PodRunning, true),
+				makePod("pod-1", "someserviceaccount", v1.PodRunning, true),
+			},
+		},
+		{
+			name:          "CnHasO",
+			expectMessage: "Subject has more than one name component",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.Organization = []string{"SomeOrg"}
+			},
+		},
+		{
+			name:          "NotInClusterDomain",
+			expectMessage: "Subject \"tls-service.somenamespace.svc.example.com\" is not in the svc.cluster.local domain",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "tls-service.somenamespace.svc.example.com"
+			},
+		},
+		{
+			name:          "PodName",
+			expectMessage: "Subject \"172-1-0-3.somenamespace.pod.cluster.local\" is not in the svc.cluster.local domain",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "172-1-0-3.somenamespace.pod.cluster.local"
+			},
+		},
+		{
+			name:          "ExtraDomainComponents",
+			expectMessage: "Subject \"web-0.tls-service.somenamespace.svc.cluster.local\" is not a Service name",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "web-0.tls-service.somenamespace.svc.cluster.local"
+			},
+		},
+		{
+			name:          "MissingNamespace",
+			expectMessage: "Subject \"tls-service.svc.cluster.local\" is not a Service name",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "tls-service.svc.cluster.local"
+			},
+		},
+		{
+			name:          "NoService",
+			expectMessage: "No Service \"other-service\" in namespace \"somenamespace\"",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "other-service.somenamespace.svc.cluster.local"
+			},
+		},
+		{
+			name:           "WrongUser",
+			serviceAccount: "system:serviceaccount:somenamespace:otherserviceaccount",
+			expectMessage:  "Requesting user \"system:serviceaccount:somenamespace:otherserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name:           "WrongUserNamespace",
+			serviceAccount: "system:serviceaccount:othernamespace:someserviceaccount",
+			expectMessage:  "Requesting user \"system:serviceaccount:othernamespace:someserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name: "IgnoresNotReadyPod",
+			objects: []runtime.Object{
+				service,
+				makePod("pod-0", "someserviceaccount", v1.PodRunning, false),
+			},
+			expectMessage: "Requesting user \"system:serviceaccount:somenamespace:someserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name: "IgnoresNotRunningPod",
+			objects: []runtime.Object{
+				service,
+				makePod("pod-0", "someserviceaccount", v1.PodSucceeded, true),
+			},
+			expectMessage: "Requesting user \"system:serviceaccount:somenamespace:someserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name: "IgnoresPodMarkedForDeletion",
+			objects: []runtime.Object{
+				service,
+				deletedPod,
+			},
+			expectMessage: "Requesting user \"system:serviceaccount:somenamespace:someserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name: "IgnoresPodNotSelected",
+			objects: []runtime.Object{
+				service,
+				otherLabelPod,
+			},
+			expectMessage: "Requesting user \"system:serviceaccount:somenamespace:someserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name: "ServiceWithoutSelector",
+			objects: []runtime.Object{
+				&v1.Service{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "tls-service",
+						Namespace: "somenamespace",
+					},
+				},
+				makePod("pod-0", "someserviceaccount", v1.PodRunning, true),
+			},
+			expectMessage: "Requesting user \"system:serviceaccount:somenamespace:someserviceaccount\" does not run a ready POD selected by Service \"tls-service\" in namespace \"somenamespace\"",
+		},
+		{
+			name:            "ConfiguredNotInClusterDomain",
+			inspectorConfig: "example.com",
+			expectMessage:   "Subject \"tls-service.somenamespace.svc.cluster.local\" is not in the svc.example.com domain",
+		},
+		{
+			name:            "ConfiguredGood",
+			inspectorConfig: "clusterdomain=example.com",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "tls-service.somenamespace.svc.example.com"
+			},
+		},
+		{
+			name:         "GlobalClusterDomain",
+			globalDomain: "example.com",
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "tls-service.somenamespace.svc.example.com"
+			},
+		},
+		{
+			name:          "GlobalAlias",
+			globalAliases: []string{"old.example.com"},
+			setupRequest: func(request *x509.CertificateRequest) {
+				request.Subject.CommonName = "tls-service.somenamespace.svc.old.example.com"
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if testcase.globalDomain != "" || testcase.globalAliases != nil {
+				domain := testcase.globalDomain
+				if domain == "" {
+					domain = clusterdomain.Default
+				}
+				clusterdomain.Set(domain, testcase.globalAliases)
+				defer clusterdomain.Set(clusterdomain.Default, nil)
+			}
+
+			inspector, exists := inspectors.Get("subjectisserviceforuser")
+			if !exists {
+				t.Fatal("Expected inspectors.Get(\"subjectisserviceforuser\") to exist, did not")
+			}
+
+			if testcase.inspectorConfig != "" {
+				var err error
+				inspector, err = inspector.Configure(testcase.inspectorConfig)
+				assert.NoError(t, err, "Configure")
+			}
+
+			if testcase.objects == nil {
+				testcase.objects = []runtime.Object{
+					service,
+					makePod("pod-0", "someserviceaccount", v1.PodRunning, true),
+				}
+			}
+			client := fake.NewSimpleClientset(testcase.objects...)
+
+			// Generate the certificate request.
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "tls-service.somenamespace.svc.cluster.local",
+				},
+				SignatureAlgorithm: x509.SHA256WithRSAPSS,
+			}
+			if testcase.setupRequest != nil {
+				testcase.setupRequest(&certificateRequestTemplate)
+			}
+
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+
+			certificateRequestBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest})
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: testcase.serviceAccount,
+					Request:  certificateRequestBytes,
+				},
+			}
+			if request.Spec.Username == "" {
+				request.Spec.Username = "system:serviceaccount:somenamespace:someserviceaccount"
+			}
+
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package weakkey
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/keycheck"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+var weakKeysFound = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "kapprover_weak_keys_found",
+		Help: "Number of weak public keys found, by type of weakness.",
+	},
+	[]string{"weakness"},
+)
+
+func init() {
+	prometheus.MustRegister(weakKeysFound)
+	inspectors.Register("weakkey", &weakkey{})
+}
+
+// Weakkey is an Inspector that verifies the CSR's public key does not have a known weakness:
+// an RSA public exponent of 1 or an even exponent, an RSA modulus with a small prime factor,
+// a ROCA-vulnerable modulus or one with primes close enough for Fermat factorization, or an
+// ECDSA point that is not on the curve or is at infinity. Each weakness found is counted in
+// the kapprover_weak_keys_found metric.
+type weakkey struct {
+}
+
+func (w *weakkey) Configure(config string) (inspectors.Inspector, error) {
+	if config != "" {
+		return nil, errors.New("configuration not supported")
+	}
+	return w, nil
+}
+
+func (w *weakkey) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	// The key is checked before the signature, as crypto/rsa and crypto/x509 refuse to verify
+	// signatures made with some of the weak keys, hiding the weakness behind a signature error.
+	publicKey, msg := csr.ExtractPublicKey(request.Spec.Request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	findings := keycheck.Check(publicKey)
+	if len(findings) == 0 {
+		_, msg = csr.Extract(request.Spec.Request)
+		return msg, nil
+	}
+
+	descriptions := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		weakKeysFound.WithLabelValues(string(finding.Weakness)).Inc()
+		descriptions = append(descriptions, finding.Description)
+	}
+	return "Weak public key: " + strings.Join(descriptions, "; "), nil
+}
@@ -0,0 +1,244 @@
+package weakkey_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"math/big"
+	"testing"
+
+	_ "github.com/proofpoint/kapprover/inspectors/weakkey"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("weakkey")
+	require.True(t, exists, "inspectors.Get(\"weakkey\") to exist")
+
+	_, err := inspector.Configure("something")
+	assert.EqualError(t, err, "configuration not supported")
+}
+
+func TestInspect(t *testing.T) {
+	prime1, err := rand.Prime(rand.Reader, 1024)
+	require.NoError(t, err, "Generate prime")
+	prime2, err := rand.Prime(rand.Reader, 1024)
+	require.NoError(t, err, "Generate prime")
+	closePrime := new(big.Int).Add(prime1, big.NewInt(1<<20))
+	for !closePrime.ProbablyPrime(20) {
+		closePrime.Add(closePrime, big.NewInt(1))
+	}
+
+	for _, testcase := range []struct {
+		name          string
+		primes        []*big.Int
+		exponent      int
+		expectMessage string
+		expectMetric  string
+	}{
+		{
+			name:   "Good",
+			primes: []*big.Int{prime1, prime2},
+		},
+		{
+			name:          "SmallFactor",
+			primes:        []*big.Int{prime1, big.NewInt(65521)},
+			expectMessage: "Weak public key: RSA modulus has a small prime factor",
+			expectMetric:  "rsa-small-factor",
+		},
+		{
+			name:          "ExponentEven",
+			primes:        []*big.Int{prime1, prime2},
+			exponent:      65536,
+			expectMessage: "Weak public key: RSA public exponent 65536 is weak",
+			expectMetric:  "rsa-exponent",
+		},
+		{
+			name:          "Roca",
+			primes:        []*big.Int{rocaPrime(t), rocaPrime(t)},
+			expectMessage: "Weak public key: RSA modulus is ROCA-vulnerable (CVE-2017-15361)",
+			expectMetric:  "rsa-roca",
+		},
+		{
+			name:          "Fermat",
+			primes:        []*big.Int{prime1, closePrime},
+			expectMessage: "Weak public key: RSA modulus has primes close enough for Fermat factorization",
+			expectMetric:  "rsa-fermat",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			inspector, exists := inspectors.Get("weakkey")
+			require.True(t, exists, "inspectors.Get(\"weakkey\") to exist")
+
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "example.invalid",
+				},
+				SignatureAlgorithm: x509.SHA256WithRSA,
+			}
+			certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, newRawRsaSigner(testcase.primes[0], testcase.primes[1]))
+			require.NoError(t, err, "Generate the CSR")
+			if testcase.exponent != 0 {
+				// Replace the exponent after signing, as crypto/x509 refuses to sign with a weak one.
+				certificateRequest = replaceOnce(t, certificateRequest, mustMarshal(t, 65537), mustMarshal(t, testcase.exponent))
+			}
+
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: "someRandomUser",
+					Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+				},
+			}
+
+			before := weakKeysFound(t, testcase.expectMetric)
+			message, err := inspector.Inspect(client, &request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.NoError(t, err)
+			if testcase.expectMetric != "" {
+				assert.Equal(t, before+1, weakKeysFound(t, testcase.expectMetric), "kapprover_weak_keys_found")
+			}
+		})
+	}
+}
+
+func TestInspectEcdsaNotOnCurve(t *testing.T) {
+	inspector, exists := inspectors.Get("weakkey")
+	require.True(t, exists, "inspectors.Get(\"weakkey\") to exist")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+	certificateRequestTemplate := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	// Move the point off the curve after signing, which also invalidates the signature.
+	point := append([]byte{4}, append(key.X.FillBytes(make([]byte, 32)), key.Y.FillBytes(make([]byte, 32))...)...)
+	offCurve := append([]byte{4}, append(key.X.FillBytes(make([]byte, 32)), new(big.Int).Add(key.Y, big.NewInt(1)).FillBytes(make([]byte, 32))...)...)
+	certificateRequest = replaceOnce(t, certificateRequest, point, offCurve)
+
+	request := certificates.CertificateSigningRequest{
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: "someRandomUser",
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+		},
+	}
+
+	before := weakKeysFound(t, "ecdsa-invalid-point")
+	message, err := inspector.Inspect(client, &request)
+	assert.Equal(t, "Weak public key: ECDSA public key is not on the curve", message, "Message")
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, weakKeysFound(t, "ecdsa-invalid-point"), "kapprover_weak_keys_found")
+}
+
+// replaceOnce replaces the single occurrence of old in der with new of the same length.
+func replaceOnce(t *testing.T, der, old, new []byte) []byte {
+	require.Equal(t, len(old), len(new), "Replacement length")
+	require.Equal(t, 1, bytes.Count(der, old), "Occurrences to replace")
+	return bytes.Replace(der, old, new, 1)
+}
+
+func mustMarshal(t *testing.T, value interface{}) []byte {
+	der, err := asn1.Marshal(value)
+	require.NoError(t, err, "Marshal")
+	return der
+}
+
+func weakKeysFound(t *testing.T, weakness string) float64 {
+	metricFamilies, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err, "Gather metrics")
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() != "kapprover_weak_keys_found" {
+			continue
+		}
+		for _, metric := range metricFamily.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "weakness" && label.GetValue() == weakness {
+					return metric.Counter.GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// rawRsaSigner signs with PKCS #1 v1.5 and SHA-256 using the bare RSA operation, as crypto/rsa
+// refuses to sign with some of the weak keys under test.
+type rawRsaSigner struct {
+	public rsa.PublicKey
+	d      *big.Int
+}
+
+func newRawRsaSigner(p, q *big.Int) *rawRsaSigner {
+	one := big.NewInt(1)
+	totient := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+	return &rawRsaSigner{
+		public: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: 65537},
+		d:      new(big.Int).ModInverse(big.NewInt(65537), totient),
+	}
+}
+
+func (r *rawRsaSigner) Public() crypto.PublicKey {
+	return &r.public
+}
+
+func (r *rawRsaSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	sha256Prefix := []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+	k := (r.public.N.BitLen() + 7) / 8
+	encoded := make([]byte, k)
+	encoded[1] = 1
+	for i := 2; i < k-len(sha256Prefix)-len(digest)-1; i++ {
+		encoded[i] = 0xff
+	}
+	copy(encoded[k-len(sha256Prefix)-len(digest):], sha256Prefix)
+	copy(encoded[k-len(digest):], digest)
+
+	signature := new(big.Int).Exp(new(big.Int).SetBytes(encoded), r.d, r.public.N)
+	return signature.FillBytes(make([]byte, k)), nil
+}
+
+// rocaPrime generates a 512-bit prime of the form used by the vulnerable Infineon library:
+// k*M + (65537^a mod M), where M is the product of the first 39 primes.
+func rocaPrime(t *testing.T) *big.Int {
+	m := big.NewInt(1)
+	for _, prime := range []int64{
+		2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97,
+		101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151, 157, 163, 167,
+	} {
+		m.Mul(m, big.NewInt(prime))
+	}
+
+	for {
+		k, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(512-m.BitLen())))
+		require.NoError(t, err, "Generate k")
+		a, err := rand.Int(rand.Reader, m)
+		require.NoError(t, err, "Generate a")
+
+		p := new(big.Int).Exp(big.NewInt(65537), a, m)
+		p.Add(p, k.Mul(k, m))
+		if p.ProbablyPrime(20) && new(big.Int).Mod(new(big.Int).Sub(p, big.NewInt(1)), big.NewInt(65537)).Sign() != 0 {
+			return p
+		}
+	}
+}
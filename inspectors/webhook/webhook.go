@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/review"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+func init() {
+	inspectors.Register("webhook", &webhook{})
+}
+
+// Webhook is an Inspector that delegates the decision to an external policy service.
+// It POSTs a review.Review describing the CSR to the configured URL and expects a
+// review.Verdict in response. Verdicts are cached by CSR UID. If the service cannot be
+// reached or gives an invalid response, the inspector either fails (the default) or,
+// if configured to fail open, takes no action.
+type webhook struct {
+	url      string
+	timeout  time.Duration
+	cacheTTL time.Duration
+	failOpen bool
+	client   *http.Client
+
+	cacheM sync.Mutex
+	cache  map[types.UID]cacheEntry
+}
+
+type cacheEntry struct {
+	message string
+	expires time.Time
+}
+
+const maxResponseSize = 64 * 1024
+
+func (w *webhook) Configure(config string) (inspectors.Inspector, error) {
+	if config == "" {
+		return w, nil
+	}
+
+	options, err := inspectors.ParseOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := webhook{
+		timeout:  10 * time.Second,
+		cacheTTL: 5 * time.Minute,
+		cache:    map[types.UID]cacheEntry{},
+	}
+	tlsConfig := tls.Config{}
+	var certFile, keyFile string
+	for _, option := range options {
+		switch option.Key {
+		case "url":
+			parsed, err := url.Parse(option.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url %q: %v", option.Value, err)
+			}
+			if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				return nil, fmt.Errorf("url %q is not an absolute http or https URL", option.Value)
+			}
+			ret.url = option.Value
+		case "timeout":
+			ret.timeout, err = parseDuration(option)
+			if err != nil {
+				return nil, err
+			}
+		case "cachettl":
+			ret.cacheTTL, err = parseDuration(option)
+			if err != nil {
+				return nil, err
+			}
+		case "failopen":
+			ret.failOpen, err = inspectors.ParseFlag(option)
+			if err != nil {
+				return nil, err
+			}
+		case "cacert":
+			pem, err := ioutil.ReadFile(option.Value)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in cacert %q", option.Value)
+			}
+		case "cert":
+			certFile = option.Value
+		case "key":
+			keyFile = option.Value
+		case "servername":
+			tlsConfig.ServerName = option.Value
+		default:
+			return nil, fmt.Errorf("unsupported option %q", option.Key)
+		}
+	}
+
+	if ret.url == "" {
+		return nil, errors.New("url must be configured")
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("cert and key must be configured together")
+	}
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	ret.client = &http.Client{
+		Timeout: ret.timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tlsConfig,
+		},
+	}
+
+	return &ret, nil
+}
+
+func parseDuration(option inspectors.Option) (time.Duration, error) {
+	duration, err := time.ParseDuration(option.Value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid %s %q", option.Key, option.Value)
+	}
+	return duration, nil
+}
+
+func (w *webhook) Inspect(client kubernetes.Interface, request *certificates.CertificateSigningRequest) (string, error) {
+	if w.url == "" {
+		return "", errors.New("webhook url not configured")
+	}
+
+	if message, ok := w.cached(request.UID); ok {
+		return message, nil
+	}
+
+	csrReview, msg := review.New(request)
+	if msg != "" {
+		return msg, nil
+	}
+
+	message, err := w.call(csrReview)
+	if err != nil {
+		if w.failOpen {
+			logrus.Warnf("Webhook failing open for %q: %s", request.Name, err)
+			return "", nil
+		}
+		return "", err
+	}
+
+	w.store(request.UID, message)
+	return message, nil
+}
+
+func (w *webhook) call(csrReview *review.Review) (string, error) {
+	body, err := json.Marshal(csrReview)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webhook returned status %s", response.Status)
+	}
+
+	responseBody, err := ioutil.ReadAll(http.MaxBytesReader(nil, response.Body, maxResponseSize))
+	if err != nil {
+		return "", err
+	}
+
+	var verdict review.Verdict
+	if err = json.Unmarshal(responseBody, &verdict); err != nil {
+		return "", fmt.Errorf("webhook returned invalid verdict: %v", err)
+	}
+
+	if verdict.Allowed {
+		return "", nil
+	}
+	if verdict.Message == "" {
+		return "Denied by webhook", nil
+	}
+	return verdict.Message, nil
+}
+
+func (w *webhook) cached(uid types.UID) (string, bool) {
+	if w.cacheTTL == 0 || uid == "" {
+		return "", false
+	}
+
+	w.cacheM.Lock()
+	defer w.cacheM.Unlock()
+
+	entry, ok := w.cache[uid]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.message, true
+}
+
+func (w *webhook) store(uid types.UID, message string) {
+	if w.cacheTTL == 0 || uid == "" {
+		return
+	}
+
+	w.cacheM.Lock()
+	defer w.cacheM.Unlock()
+
+	now := time.Now()
+	for key, entry := range w.cache {
+		if now.After(entry.expires) {
+			delete(w.cache, key)
+		}
+	}
+	w.cache[uid] = cacheEntry{message: message, expires: now.Add(w.cacheTTL)}
+}
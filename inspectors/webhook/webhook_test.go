@@ -0,0 +1,361 @@
+package webhook_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/proofpoint/kapprover/inspectors"
+	"github.com/proofpoint/kapprover/review"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/proofpoint/kapprover/inspectors/webhook"
+)
+
+var (
+	client *kubernetes.Clientset
+)
+
+func TestConfigure(t *testing.T) {
+	inspector, exists := inspectors.Get("webhook")
+	require.True(t, exists, "inspectors.Get(\"webhook\") to exist")
+
+	for config, expectErr := range map[string]string{
+		"timeout=5s":                                   "url must be configured",
+		"url=ftp://example.invalid/":                   "url \"ftp://example.invalid/\" is not an absolute http or https URL",
+		"url=/relative":                                "url \"/relative\" is not an absolute http or https URL",
+		"url=https://example.invalid/,foo=bar":         "unsupported option \"foo\"",
+		"url=https://example.invalid/,timeout=soon":    "invalid timeout \"soon\"",
+		"url=https://example.invalid/,cachettl=-1s":    "invalid cachettl \"-1s\"",
+		"url=https://example.invalid/,failopen=maybe":  "invalid failopen \"maybe\"",
+		"url=https://example.invalid/,cert=client.crt": "cert and key must be configured together",
+	} {
+		_, err := inspector.Configure(config)
+		assert.EqualError(t, err, expectErr, config)
+	}
+
+	_, err := inspector.Inspect(client, makeRequest(t, "someuid"))
+	assert.EqualError(t, err, "webhook url not configured", "unconfigured Inspect")
+}
+
+func TestInspect(t *testing.T) {
+	for _, testcase := range []struct {
+		name          string
+		status        int
+		response      string
+		config        string
+		expectMessage string
+		expectErr     string
+	}{
+		{
+			name:     "Allowed",
+			status:   http.StatusOK,
+			response: `{"allowed": true, "message": "ignored"}`,
+		},
+		{
+			name:          "Denied",
+			status:        http.StatusOK,
+			response:      `{"allowed": false, "message": "Not on my watch"}`,
+			expectMessage: "Not on my watch",
+		},
+		{
+			name:          "DeniedNoMessage",
+			status:        http.StatusOK,
+			response:      `{}`,
+			expectMessage: "Denied by webhook",
+		},
+		{
+			name:      "ServerError",
+			status:    http.StatusInternalServerError,
+			response:  `{"allowed": true}`,
+			expectErr: "webhook returned status 500 Internal Server Error",
+		},
+		{
+			name:      "InvalidVerdict",
+			status:    http.StatusOK,
+			response:  `allowed`,
+			expectErr: "webhook returned invalid verdict: invalid character 'a' looking for beginning of value",
+		},
+		{
+			name:     "ServerErrorFailOpen",
+			status:   http.StatusInternalServerError,
+			config:   ",failopen",
+			response: `{"allowed": false}`,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var received review.Review
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method, "method")
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"), "Content-Type")
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&received), "decode review")
+				w.WriteHeader(testcase.status)
+				w.Write([]byte(testcase.response))
+			}))
+			defer server.Close()
+
+			inspector, exists := inspectors.Get("webhook")
+			require.True(t, exists, "inspectors.Get(\"webhook\") to exist")
+			inspector, err := inspector.Configure("url=" + server.URL + testcase.config)
+			require.NoError(t, err, "Configure")
+
+			request := makeRequest(t, "someuid")
+			message, err := inspector.Inspect(client, request)
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			if testcase.expectErr == "" {
+				assert.NoError(t, err, "Error")
+			} else {
+				assert.EqualError(t, err, testcase.expectErr, "Error")
+			}
+
+			assert.Equal(t, "someuid", received.UID, "review uid")
+			assert.Equal(t, "system:serviceaccount:somenamespace:someaccount", received.Username, "review username")
+			assert.Equal(t, []string{"system:serviceaccounts", "system:authenticated"}, received.Groups, "review groups")
+			assert.Equal(t, []string{"digital signature", "server auth"}, received.Usages, "review usages")
+			assert.Equal(t, string(request.Spec.Request), received.Request, "review request")
+			assert.Equal(t, "example.invalid", received.CertificateRequest.Subject.CommonName, "review CN")
+			assert.Equal(t, []string{"example.invalid"}, received.CertificateRequest.DNSNames, "review dnsNames")
+			assert.Equal(t, []string{"10.1.2.3"}, received.CertificateRequest.IPAddresses, "review ipAddresses")
+			if assert.Len(t, received.CertificateRequest.SubjectAltNames, 2, "review subjectAltNames") {
+				assert.Equal(t, "dns", received.CertificateRequest.SubjectAltNames[0].Type, "review subjectAltNames type")
+				assert.Equal(t, "example.invalid", received.CertificateRequest.SubjectAltNames[0].Value, "review subjectAltNames value")
+				assert.Equal(t, "ip", received.CertificateRequest.SubjectAltNames[1].Type, "review subjectAltNames type")
+				assert.Equal(t, "10.1.2.3", received.CertificateRequest.SubjectAltNames[1].Value, "review subjectAltNames value")
+			}
+			assert.Equal(t, "RSA", received.CertificateRequest.PublicKeyAlgorithm, "review publicKeyAlgorithm")
+			assert.Equal(t, 1024, received.CertificateRequest.PublicKeyBits, "review publicKeyBits")
+			assert.Equal(t, "SHA256-RSA", received.CertificateRequest.SignatureAlgorithm, "review signatureAlgorithm")
+		})
+	}
+}
+
+func TestInspectUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	inspector, exists := inspectors.Get("webhook")
+	require.True(t, exists, "inspectors.Get(\"webhook\") to exist")
+
+	failClosed, err := inspector.Configure("url=" + server.URL + ",timeout=1s")
+	require.NoError(t, err, "Configure")
+	_, err = failClosed.Inspect(client, makeRequest(t, "someuid"))
+	assert.Error(t, err, "fail closed")
+
+	failOpen, err := inspector.Configure("url=" + server.URL + ",timeout=1s,failopen=true")
+	require.NoError(t, err, "Configure")
+	message, err := failOpen.Inspect(client, makeRequest(t, "someuid"))
+	assert.Equal(t, "", message, "fail open message")
+	assert.NoError(t, err, "fail open")
+}
+
+func TestInspectCached(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"allowed": false, "message": "Denied"}`))
+	}))
+	defer server.Close()
+
+	inspector, exists := inspectors.Get("webhook")
+	require.True(t, exists, "inspectors.Get(\"webhook\") to exist")
+
+	cached, err := inspector.Configure("url=" + server.URL)
+	require.NoError(t, err, "Configure")
+	for _, uid := range []string{"uid1", "uid1", "uid2", "uid1"} {
+		message, err := cached.Inspect(client, makeRequest(t, uid))
+		assert.Equal(t, "Denied", message, "Message")
+		assert.NoError(t, err, "Error")
+	}
+	assert.Equal(t, 2, calls, "calls with cache")
+
+	calls = 0
+	uncached, err := inspector.Configure("url=" + server.URL + ",cachettl=0s")
+	require.NoError(t, err, "Configure")
+	for _, uid := range []string{"uid1", "uid1"} {
+		_, err := uncached.Inspect(client, makeRequest(t, uid))
+		assert.NoError(t, err, "Error")
+	}
+	assert.Equal(t, 2, calls, "calls without cache")
+}
+
+func TestInspectClientAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	require.NoError(t, err, "TempDir")
+	defer func() {
+		assert.NoError(t, os.RemoveAll(dir))
+	}()
+
+	clientCert, clientKey := makeClientCertificate(t)
+	clientCertFile := filepath.Join(dir, "client.crt")
+	clientKeyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, ioutil.WriteFile(clientCertFile, clientCert, 0600))
+	require.NoError(t, ioutil.WriteFile(clientKeyFile, clientKey, 0600))
+
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(clientCert), "client CA pool")
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "kapprover" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"allowed": true}`))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	inspector, exists := inspectors.Get("webhook")
+	require.True(t, exists, "inspectors.Get(\"webhook\") to exist")
+
+	inspector, err = inspector.Configure("url=" + server.URL + ",cacert=" + caFile + ",cert=" + clientCertFile + ",key=" + clientKeyFile)
+	require.NoError(t, err, "Configure")
+	message, err := inspector.Inspect(client, makeRequest(t, "someuid"))
+	assert.Equal(t, "", message, "Message")
+	assert.NoError(t, err, "Error")
+
+	var noClientCert inspectors.Inspectors
+	require.NoError(t, noClientCert.Set("webhook=url="+server.URL+",cacert="+caFile))
+	_, err = noClientCert[0].Inspector.Inspect(client, makeRequest(t, "otheruid"))
+	assert.Error(t, err, "without client certificate")
+}
+
+func TestInspectSubjectAltNames(t *testing.T) {
+	var received review.Review
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received), "decode review")
+		w.Write([]byte(`{"allowed": true}`))
+	}))
+	defer server.Close()
+
+	inspector, exists := inspectors.Get("webhook")
+	require.True(t, exists, "inspectors.Get(\"webhook\") to exist")
+	inspector, err := inspector.Configure("url=" + server.URL + ",cachettl=0s")
+	require.NoError(t, err, "Configure")
+
+	dnsName := []byte{0x82, 15}
+	dnsName = append(dnsName, "example.invalid"...)
+	upn := []byte{0xa0, 0x27, 0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x14, 0x02, 0x03, 0xa0, 0x19, 0x0c, 0x17}
+	upn = append(upn, "someone@example.invalid"...)
+	registeredID := []byte{0x88, 0x02, 0x2a, 0x03}
+
+	for _, testcase := range []struct {
+		name          string
+		names         [][]byte
+		expectMessage string
+		expectNames   []review.SubjectAltName
+	}{
+		{
+			name:  "AllTypes",
+			names: [][]byte{dnsName, upn, registeredID},
+			expectNames: []review.SubjectAltName{
+				{Type: "dns", Value: "example.invalid", Raw: dnsName},
+				{Type: "otherName", Value: "someone@example.invalid", OID: "1.3.6.1.4.1.311.20.2.3", Raw: upn},
+				{Type: "registeredID", OID: "1.2.3", Raw: registeredID},
+			},
+		},
+		{
+			name:          "Malformed",
+			names:         [][]byte{dnsName, {0x82, 0x00}},
+			expectMessage: "Malformed Subject Alt Name 2: empty DNS name",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			received = review.Review{}
+			subjectAltNames, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: bytes.Join(testcase.names, nil)})
+			require.NoError(t, err, "Marshal the SubjectAltName extension")
+
+			request := makeRequestFromTemplate(t, "someuid", x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "example.invalid",
+				},
+				SignatureAlgorithm: x509.SHA256WithRSA,
+				ExtraExtensions: []pkix.Extension{
+					{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: subjectAltNames},
+				},
+			})
+			message, err := inspector.Inspect(client, request)
+			assert.NoError(t, err, "Error")
+			assert.Equal(t, testcase.expectMessage, message, "Message")
+			assert.Equal(t, testcase.expectNames, received.CertificateRequest.SubjectAltNames, "review subjectAltNames")
+		})
+	}
+}
+
+func makeRequest(t *testing.T, uid string) *certificates.CertificateSigningRequest {
+	return makeRequestFromTemplate(t, uid, x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "example.invalid",
+		},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+		DNSNames:           []string{"example.invalid"},
+		IPAddresses:        []net.IP{net.ParseIP("10.1.2.3")},
+	})
+}
+
+func makeRequestFromTemplate(t *testing.T, uid string, certificateRequestTemplate x509.CertificateRequest) *certificates.CertificateSigningRequest {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err, "Generate the private key")
+
+	certificateRequest, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	return &certificates.CertificateSigningRequest{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name: "somerequest",
+			UID:  types.UID(uid),
+		},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: "system:serviceaccount:somenamespace:someaccount",
+			Groups:   []string{"system:serviceaccounts", "system:authenticated"},
+			Usages:   []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageServerAuth},
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: certificateRequest}),
+		},
+	}
+}
+
+func makeClientCertificate(t *testing.T) (certPem []byte, keyPem []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the client key")
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kapprover"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err, "Generate the client certificate")
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
@@ -82,7 +82,7 @@ func ServePrometheusMetrics(port int) {
 	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(port), nil))
 }
 
-func HandleRequests(filters inspectors.Inspectors, deniers inspectors.Inspectors, warners inspectors.Inspectors, deleteAfter time.Duration, client *kubernetes.Clientset) {
+func HandleRequests(filters inspectors.Inspectors, deniers inspectors.Inspectors, warners inspectors.Inspectors, deleteAfter time.Duration, client kubernetes.Interface) {
 	//Register prometheus metrics
 	registerPrometheusMetrics()
 
@@ -121,7 +121,7 @@ func HandleRequests(filters inspectors.Inspectors, deniers inspectors.Inspectors
 	controller.Run(make(chan struct{}))
 }
 
-func tryApprove(filters inspectors.Inspectors, deniers inspectors.Inspectors, warners inspectors.Inspectors, deleteAfter time.Duration, client *kubernetes.Clientset, request *certificates.CertificateSigningRequest) error {
+func tryApprove(filters inspectors.Inspectors, deniers inspectors.Inspectors, warners inspectors.Inspectors, deleteAfter time.Duration, client kubernetes.Interface, request *certificates.CertificateSigningRequest) error {
 	for {
 		// Verify that the CSR hasn't been approved or denied already.
 		//
@@ -210,7 +210,7 @@ func tryApprove(filters inspectors.Inspectors, deniers inspectors.Inspectors, wa
 	}
 }
 
-func scheduleDelete(deleteAfter time.Duration, client *kubernetes.Clientset, requestName string) {
+func scheduleDelete(deleteAfter time.Duration, client kubernetes.Interface, requestName string) {
 	{
 		scheduledMux.Lock()
 		defer scheduledMux.Unlock()
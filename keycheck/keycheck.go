@@ -0,0 +1,159 @@
+package keycheck
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// Weakness identifies a type of known-bad public key.
+type Weakness string
+
+const (
+	RsaExponent       Weakness = "rsa-exponent"
+	RsaSmallFactor    Weakness = "rsa-small-factor"
+	RsaRoca           Weakness = "rsa-roca"
+	RsaFermat         Weakness = "rsa-fermat"
+	EcdsaInvalidPoint Weakness = "ecdsa-invalid-point"
+)
+
+// Finding is a weakness found in a public key, with a human readable description.
+type Finding struct {
+	Weakness    Weakness
+	Description string
+}
+
+const (
+	// Moduli are checked for prime factors below this limit.
+	smallPrimeLimit = 1 << 16
+	// Number of Fermat factorization steps to attempt, which finds primes
+	// that differ by less than about 2*sqrt(fermatRounds)*N^(1/4).
+	fermatRounds = 100
+	// The generator of the primes produced by the vulnerable Infineon library.
+	rocaGenerator = 65537
+)
+
+// Small primes used to fingerprint ROCA-vulnerable moduli, which are congruent modulo each of
+// them to a power of rocaGenerator.
+var rocaPrimes = []int64{
+	3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97,
+	101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151, 157, 163, 167,
+}
+
+var (
+	setupOnce         sync.Once
+	smallPrimeProduct *big.Int
+	rocaSubgroups     []map[int64]bool
+)
+
+func setup() {
+	sieve := make([]bool, smallPrimeLimit)
+	smallPrimeProduct = big.NewInt(1)
+	for i := 2; i < smallPrimeLimit; i++ {
+		if sieve[i] {
+			continue
+		}
+		smallPrimeProduct.Mul(smallPrimeProduct, big.NewInt(int64(i)))
+		for j := i * i; j < smallPrimeLimit; j += i {
+			sieve[j] = true
+		}
+	}
+
+	rocaSubgroups = make([]map[int64]bool, len(rocaPrimes))
+	for i, prime := range rocaPrimes {
+		subgroup := map[int64]bool{}
+		element := int64(1)
+		for !subgroup[element] {
+			subgroup[element] = true
+			element = element * rocaGenerator % prime
+		}
+		rocaSubgroups[i] = subgroup
+	}
+}
+
+// Check returns the known weaknesses of an RSA or ECDSA public key.
+// Other types of key have no findings.
+func Check(publicKey interface{}) []Finding {
+	setupOnce.Do(setup)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return checkRsa(key)
+	case *ecdsa.PublicKey:
+		return checkEcdsa(key)
+	}
+	return nil
+}
+
+func checkRsa(key *rsa.PublicKey) []Finding {
+	var findings []Finding
+
+	if key.E == 1 || key.E%2 == 0 {
+		findings = append(findings, Finding{RsaExponent, fmt.Sprintf("RSA public exponent %d is weak", key.E)})
+	}
+
+	if key.N == nil || key.N.Sign() <= 0 {
+		return append(findings, Finding{RsaSmallFactor, "RSA modulus is not positive"})
+	}
+
+	if gcd := new(big.Int).GCD(nil, nil, key.N, smallPrimeProduct); gcd.Cmp(big.NewInt(1)) != 0 {
+		findings = append(findings, Finding{RsaSmallFactor, "RSA modulus has a small prime factor"})
+	}
+
+	if isRoca(key.N) {
+		findings = append(findings, Finding{RsaRoca, "RSA modulus is ROCA-vulnerable (CVE-2017-15361)"})
+	}
+
+	if isFermatFactorable(key.N) {
+		findings = append(findings, Finding{RsaFermat, "RSA modulus has primes close enough for Fermat factorization"})
+	}
+
+	return findings
+}
+
+func isRoca(n *big.Int) bool {
+	remainder := new(big.Int)
+	for i, prime := range rocaPrimes {
+		remainder.Mod(n, big.NewInt(prime))
+		if !rocaSubgroups[i][remainder.Int64()] {
+			return false
+		}
+	}
+	return true
+}
+
+func isFermatFactorable(n *big.Int) bool {
+	one := big.NewInt(1)
+	a := new(big.Int).Sqrt(n)
+	if new(big.Int).Mul(a, a).Cmp(n) < 0 {
+		a.Add(a, one)
+	}
+
+	bSquared := new(big.Int)
+	b := new(big.Int)
+	square := new(big.Int)
+	factor := new(big.Int)
+	for i := 0; i < fermatRounds; i++ {
+		bSquared.Mul(a, a)
+		bSquared.Sub(bSquared, n)
+		b.Sqrt(bSquared)
+		if square.Mul(b, b).Cmp(bSquared) == 0 {
+			// n = (a-b)(a+b); a-b of 1 is the trivial factorization.
+			return factor.Sub(a, b).Cmp(one) > 0
+		}
+		a.Add(a, one)
+	}
+	return false
+}
+
+func checkEcdsa(key *ecdsa.PublicKey) []Finding {
+	if key.X == nil || key.Y == nil || (key.X.Sign() == 0 && key.Y.Sign() == 0) {
+		return []Finding{{EcdsaInvalidPoint, "ECDSA public key is the point at infinity"}}
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return []Finding{{EcdsaInvalidPoint, "ECDSA public key is not on the curve"}}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package keycheck_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/proofpoint/kapprover/keycheck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+)
+
+func TestCheckGoodKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+	ed25519Key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	assert.Empty(t, keycheck.Check(&rsaKey.PublicKey), "RSA")
+	assert.Empty(t, keycheck.Check(&ecdsaKey.PublicKey), "ECDSA")
+	assert.Empty(t, keycheck.Check(ed25519Key), "Ed25519")
+}
+
+func TestCheckRsa(t *testing.T) {
+	prime1, err := rand.Prime(rand.Reader, 1024)
+	require.NoError(t, err, "Generate prime")
+	prime2, err := rand.Prime(rand.Reader, 1024)
+	require.NoError(t, err, "Generate prime")
+	good := new(big.Int).Mul(prime1, prime2)
+
+	for _, testcase := range []struct {
+		name          string
+		key           rsa.PublicKey
+		expectFinding []keycheck.Finding
+	}{
+		{
+			name:          "ExponentOne",
+			key:           rsa.PublicKey{N: good, E: 1},
+			expectFinding: []keycheck.Finding{{keycheck.RsaExponent, "RSA public exponent 1 is weak"}},
+		},
+		{
+			name:          "ExponentEven",
+			key:           rsa.PublicKey{N: good, E: 65536},
+			expectFinding: []keycheck.Finding{{keycheck.RsaExponent, "RSA public exponent 65536 is weak"}},
+		},
+		{
+			name:          "ExponentThree",
+			key:           rsa.PublicKey{N: good, E: 3},
+			expectFinding: nil,
+		},
+		{
+			name:          "SmallFactor",
+			key:           rsa.PublicKey{N: new(big.Int).Mul(prime1, big.NewInt(65521)), E: 65537},
+			expectFinding: []keycheck.Finding{{keycheck.RsaSmallFactor, "RSA modulus has a small prime factor"}},
+		},
+		{
+			name:          "EvenModulus",
+			key:           rsa.PublicKey{N: new(big.Int).Lsh(prime1, 1), E: 65537},
+			expectFinding: []keycheck.Finding{{keycheck.RsaSmallFactor, "RSA modulus has a small prime factor"}},
+		},
+		{
+			name:          "ZeroModulus",
+			key:           rsa.PublicKey{N: big.NewInt(0), E: 65537},
+			expectFinding: []keycheck.Finding{{keycheck.RsaSmallFactor, "RSA modulus is not positive"}},
+		},
+		{
+			name:          "Roca",
+			key:           rsa.PublicKey{N: new(big.Int).Mul(rocaPrime(t), rocaPrime(t)), E: 65537},
+			expectFinding: []keycheck.Finding{{keycheck.RsaRoca, "RSA modulus is ROCA-vulnerable (CVE-2017-15361)"}},
+		},
+		{
+			name:          "Fermat",
+			key:           rsa.PublicKey{N: new(big.Int).Mul(prime1, nextPrime(new(big.Int).Add(prime1, big.NewInt(1<<40)))), E: 65537},
+			expectFinding: []keycheck.Finding{{keycheck.RsaFermat, "RSA modulus has primes close enough for Fermat factorization"}},
+		},
+		{
+			name:          "Square",
+			key:           rsa.PublicKey{N: new(big.Int).Mul(prime1, prime1), E: 65537},
+			expectFinding: []keycheck.Finding{{keycheck.RsaFermat, "RSA modulus has primes close enough for Fermat factorization"}},
+		},
+		{
+			name: "Multiple",
+			key:  rsa.PublicKey{N: new(big.Int).Mul(prime1, big.NewInt(3)), E: 1},
+			expectFinding: []keycheck.Finding{
+				{keycheck.RsaExponent, "RSA public exponent 1 is weak"},
+				{keycheck.RsaSmallFactor, "RSA modulus has a small prime factor"},
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			assert.Equal(t, testcase.expectFinding, keycheck.Check(&testcase.key))
+		})
+	}
+}
+
+func TestCheckEcdsa(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Generate the private key")
+
+	notOnCurve := ecdsa.PublicKey{Curve: elliptic.P256(), X: key.X, Y: new(big.Int).Add(key.Y, big.NewInt(1))}
+	assert.Equal(t, []keycheck.Finding{{keycheck.EcdsaInvalidPoint, "ECDSA public key is not on the curve"}}, keycheck.Check(&notOnCurve), "not on curve")
+
+	infinity := ecdsa.PublicKey{Curve: elliptic.P256(), X: big.NewInt(0), Y: big.NewInt(0)}
+	assert.Equal(t, []keycheck.Finding{{keycheck.EcdsaInvalidPoint, "ECDSA public key is the point at infinity"}}, keycheck.Check(&infinity), "infinity")
+}
+
+// rocaPrime generates a 512-bit prime of the form used by the vulnerable Infineon library:
+// k*M + (65537^a mod M), where M is the product of the first 39 primes.
+func rocaPrime(t *testing.T) *big.Int {
+	m := big.NewInt(1)
+	for _, prime := range []int64{
+		2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97,
+		101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151, 157, 163, 167,
+	} {
+		m.Mul(m, big.NewInt(prime))
+	}
+
+	for {
+		k, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(512-m.BitLen())))
+		require.NoError(t, err, "Generate k")
+		a, err := rand.Int(rand.Reader, m)
+		require.NoError(t, err, "Generate a")
+
+		p := new(big.Int).Exp(big.NewInt(65537), a, m)
+		p.Add(p, k.Mul(k, m))
+		if p.ProbablyPrime(20) {
+			return p
+		}
+	}
+}
+
+func nextPrime(n *big.Int) *big.Int {
+	ret := new(big.Int).Set(n)
+	for !ret.ProbablyPrime(20) {
+		ret.Add(ret, big.NewInt(1))
+	}
+	return ret
+}
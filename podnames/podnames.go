@@ -4,55 +4,219 @@ import (
 	"context"
 	"fmt"
 	"k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"net"
 	"strings"
 )
 
+// Options controls which names GetNamesForPodWithOptions permits.
+type Options struct {
+	// ClusterDomain is the cluster's DNS domain.
+	ClusterDomain string
+	// ClusterDomainAliases are other DNS domains the cluster is known by, in which the POD is
+	// permitted the same names as in ClusterDomain.
+	ClusterDomainAliases []string
+	// AllowUnqualified permits Service names without the cluster domain.
+	AllowUnqualified bool
+	// EndpointSlices permits the names of Services whose EndpointSlices refer to the POD, such as
+	// Services without selectors whose endpoints are managed manually.
+	EndpointSlices bool
+	// NotReadyEndpoints counts EndpointSlice endpoints that are not ready as referring to the POD.
+	NotReadyEndpoints bool
+	// OmitHeadlessServiceNames withholds the names of headless Services, permitting only the
+	// per-POD names that cluster DNS publishes for their endpoints.
+	OmitHeadlessServiceNames bool
+	// LoadBalancerIngress permits the IPs and hostnames in the load balancer status of Services.
+	LoadBalancerIngress bool
+	// LoadBalancerAnnotation, if set, restricts LoadBalancerIngress to Services that have this
+	// annotation with the value "true".
+	LoadBalancerAnnotation string
+	// Ingresses permits the hosts of Ingress rules with paths to the Services, and the TLS hosts among
+	// them or, for Ingresses whose default backend is one of the Services, all TLS hosts, if permitted
+	// by HostnameSuffixes.
+	Ingresses bool
+	// ExternalDNSAnnotation, if set, permits the comma-separated hostnames in this annotation on the
+	// Services, if permitted by HostnameSuffixes.
+	ExternalDNSAnnotation string
+	// ClusterSetDomain, if set, permits names in this multi-cluster domain for Services that have
+	// an MCS ServiceExport.
+	ClusterSetDomain string
+	// HostnameSuffixes maps a namespace, or "*" for every namespace, to the hostnames that Ingresses
+	// and Service annotations in that namespace may grant. A hostname starting with "." permits any
+	// name with that suffix.
+	HostnameSuffixes map[string][]string
+}
+
+// DynamicClient is implemented by clients that can also read resources for which there is no typed
+// client, such as MCS ServiceExports. Names that depend on such resources are only permitted when
+// using such a client.
+type DynamicClient interface {
+	Dynamic() dynamic.Interface
+}
+
+var serviceExportResource = schema.GroupVersionResource{
+	Group:    "multicluster.x-k8s.io",
+	Version:  "v1alpha1",
+	Resource: "serviceexports",
+}
+
 // GetNamesForPod returns the DNS names and IPs that a given POD is permitted to have, either in its own right
 // or by dint of matching services.
-// Does not currently pay attention to static Endpoints.
 func GetNamesForPod(client kubernetes.Interface, pod v1.Pod, clusterDomain string, allowUnqualified bool) (dnsnames []string, ips []net.IP, err error) {
-	dnsnames = []string{fmt.Sprintf("%s.%s.pod.%s", ipToName(pod.Status.PodIP), pod.Namespace, clusterDomain)}
-	if pod.Spec.Hostname != "" && pod.Spec.Subdomain != "" {
-		dnsnames = append(dnsnames, fmt.Sprintf("%s.%s.%s.svc.%s", pod.Spec.Hostname, pod.Spec.Subdomain, pod.Namespace, clusterDomain))
-		if allowUnqualified {
-			dnsnames = append(dnsnames, fmt.Sprintf("%s.%s.%s.svc", pod.Spec.Hostname, pod.Spec.Subdomain, pod.Namespace))
+	return GetNamesForPodWithOptions(client, pod, Options{ClusterDomain: clusterDomain, AllowUnqualified: allowUnqualified})
+}
+
+// GetNamesForPodWithOptions returns the DNS names and IPs that a given POD is permitted to have, either in its
+// own right or by dint of services that select it or, if enabled, have EndpointSlices that refer to it.
+func GetNamesForPodWithOptions(client kubernetes.Interface, pod v1.Pod, options Options) (dnsnames []string, ips []net.IP, err error) {
+	domains := append([]string{options.ClusterDomain}, options.ClusterDomainAliases...)
+	podIps := PodIps(pod)
+	for _, podIp := range podIps {
+		for _, domain := range domains {
+			dnsnames = append(dnsnames, fmt.Sprintf("%s.%s.pod.%s", ipToName(podIp), pod.Namespace, domain))
+		}
+		appendIp(&ips, podIp)
+	}
+	seen := map[string]bool{}
+	addServiceName := func(name string) {
+		name = fmt.Sprintf("%s.%s.svc", name, pod.Namespace)
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, domain := range domains {
+			dnsnames = append(dnsnames, name+"."+domain)
+		}
+		if options.AllowUnqualified {
+			dnsnames = append(dnsnames, name)
 		}
 	}
 
-	ips = []net.IP{net.ParseIP(pod.Status.PodIP)}
+	if pod.Spec.Hostname != "" && pod.Spec.Subdomain != "" {
+		addServiceName(pod.Spec.Hostname + "." + pod.Spec.Subdomain)
+	}
 
 	podLabels := labels.Set(pod.Labels)
-
 	serviceList, err := client.CoreV1().Services(pod.Namespace).List(context.TODO(), metaV1.ListOptions{})
 	if err != nil {
 		return nil, nil, err
 	}
+
+	matched := map[string]bool{}
+	endpointHostnames := map[string]string{}
 	for _, service := range serviceList.Items {
 		if service.Spec.Selector == nil {
 			continue
 		}
 		selector := labels.Set(service.Spec.Selector).AsSelectorPreValidated()
 		if selector.Matches(podLabels) {
-			dnsnames = append(dnsnames, fmt.Sprintf("%s.%s.svc.%s", service.Name, service.Namespace, clusterDomain))
-			if allowUnqualified {
-				dnsnames = append(dnsnames, fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace))
+			matched[service.Name] = true
+		}
+	}
+
+	if options.EndpointSlices {
+		sliceList, err := client.DiscoveryV1beta1().EndpointSlices(pod.Namespace).List(context.TODO(), metaV1.ListOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, slice := range sliceList.Items {
+			serviceName := slice.Labels[discovery.LabelServiceName]
+			if serviceName == "" {
+				continue
+			}
+			if endpoint := endpointForPod(slice, pod, options.NotReadyEndpoints); endpoint != nil {
+				matched[serviceName] = true
+				if endpoint.Hostname != nil && *endpoint.Hostname != "" {
+					endpointHostnames[serviceName] = *endpoint.Hostname
+				}
 			}
+		}
+	}
 
-			if service.Spec.Type == v1.ServiceTypeExternalName {
-				if service.Spec.ExternalName != "" {
-					dnsnames = append(dnsnames, service.Spec.ExternalName)
+	services := map[string]bool{}
+	for _, service := range serviceList.Items {
+		if !matched[service.Name] {
+			continue
+		}
+		services[service.Name] = true
+		headless := service.Spec.ClusterIP == v1.ClusterIPNone
+		if headless {
+			// Cluster DNS publishes a record for each endpoint of a headless service, named by
+			// the endpoint's hostname if it has one and by its IP otherwise.
+			for _, podIp := range podIps {
+				addServiceName(ipToName(podIp) + "." + service.Name)
+			}
+			if pod.Spec.Hostname != "" && pod.Spec.Subdomain == service.Name {
+				addServiceName(pod.Spec.Hostname + "." + service.Name)
+			}
+			if hostname, ok := endpointHostnames[service.Name]; ok {
+				addServiceName(hostname + "." + service.Name)
+			}
+		}
+		if !headless || !options.OmitHeadlessServiceNames {
+			addServiceName(service.Name)
+		}
+		if options.ClusterSetDomain != "" {
+			exported, err := isExported(client, service)
+			if err != nil {
+				return nil, nil, err
+			}
+			if exported {
+				dnsnames = append(dnsnames, fmt.Sprintf("%s.%s.svc.%s", service.Name, service.Namespace, options.ClusterSetDomain))
+			}
+		}
+		if service.Spec.Type == v1.ServiceTypeExternalName {
+			if service.Spec.ExternalName != "" {
+				dnsnames = append(dnsnames, service.Spec.ExternalName)
+			}
+		} else {
+			clusterIps := service.Spec.ClusterIPs
+			if len(clusterIps) == 0 {
+				clusterIps = []string{service.Spec.ClusterIP}
+			}
+			for _, clusterIp := range clusterIps {
+				appendIp(&ips, clusterIp)
+			}
+		}
+		if service.Spec.ExternalIPs != nil {
+			for _, externalIp := range service.Spec.ExternalIPs {
+				appendIp(&ips, externalIp)
+			}
+		}
+		if options.ExternalDNSAnnotation != "" {
+			for _, hostname := range strings.Split(service.Annotations[options.ExternalDNSAnnotation], ",") {
+				hostname = strings.TrimSpace(hostname)
+				if hostname != "" && options.hostnamePermitted(pod.Namespace, hostname) {
+					dnsnames = append(dnsnames, hostname)
+				}
+			}
+		}
+		if options.LoadBalancerIngress && (options.LoadBalancerAnnotation == "" || service.Annotations[options.LoadBalancerAnnotation] == "true") {
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				appendIp(&ips, ingress.IP)
+				if ingress.Hostname != "" {
+					dnsnames = append(dnsnames, ingress.Hostname)
 				}
-			} else {
-				appendIp(&ips, service.Spec.ClusterIP)
 			}
+		}
+	}
 
-			if service.Spec.ExternalIPs != nil {
-				for _, externalIp := range service.Spec.ExternalIPs {
-					appendIp(&ips, externalIp)
+	if options.Ingresses && len(services) > 0 {
+		ingressList, err := client.NetworkingV1().Ingresses(pod.Namespace).List(context.TODO(), metaV1.ListOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ingress := range ingressList.Items {
+			for _, host := range ingressHosts(ingress, services) {
+				if options.hostnamePermitted(pod.Namespace, host) {
+					dnsnames = append(dnsnames, host)
 				}
 			}
 		}
@@ -61,7 +225,192 @@ func GetNamesForPod(client kubernetes.Interface, pod v1.Pod, clusterDomain strin
 	return
 }
 
+// isExported reports whether the Service has an MCS ServiceExport. A Service is not exported if the
+// client cannot read ServiceExports or the ServiceExport CRD is not installed.
+func isExported(client kubernetes.Interface, service v1.Service) (bool, error) {
+	dynamicClient, ok := client.(DynamicClient)
+	if !ok {
+		return false, nil
+	}
+	_, err := dynamicClient.Dynamic().Resource(serviceExportResource).Namespace(service.Namespace).Get(context.TODO(), service.Name, metaV1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ingressHosts returns the hosts of the Ingress that route to one of the services: the hosts of rules
+// with a path to one of them, and the TLS hosts that are among those or, if one of them is the default
+// backend, all TLS hosts.
+func ingressHosts(ingress networking.Ingress, services map[string]bool) []string {
+	var hosts []string
+	routed := map[string]bool{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host == "" || rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service != nil && services[path.Backend.Service.Name] {
+				if !routed[strings.ToLower(rule.Host)] {
+					routed[strings.ToLower(rule.Host)] = true
+					hosts = append(hosts, rule.Host)
+				}
+				break
+			}
+		}
+	}
+
+	backend := ingress.Spec.DefaultBackend
+	isDefault := backend != nil && backend.Service != nil && services[backend.Service.Name]
+	for _, tls := range ingress.Spec.TLS {
+		for _, host := range tls.Hosts {
+			if isDefault || routed[strings.ToLower(host)] {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// hostnamePermitted reports whether HostnameSuffixes permits the namespace to grant the hostname.
+func (o Options) hostnamePermitted(namespace, hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, key := range []string{namespace, "*"} {
+		for _, suffix := range o.HostnameSuffixes[key] {
+			suffix = strings.ToLower(suffix)
+			if hostname == suffix || (strings.HasPrefix(suffix, ".") && strings.HasSuffix(hostname, suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endpointForPod returns the first endpoint in the slice that refers to the POD, either by a target
+// reference or by address, or nil if there is none.
+func endpointForPod(slice discovery.EndpointSlice, pod v1.Pod, notReady bool) *discovery.Endpoint {
+	for i := range slice.Endpoints {
+		endpoint := &slice.Endpoints[i]
+		if !notReady && endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+			continue
+		}
+		if ref := endpoint.TargetRef; ref != nil && ref.Kind == "Pod" {
+			if ref.Name == pod.Name && (ref.Namespace == "" || ref.Namespace == pod.Namespace) && (ref.UID == "" || ref.UID == pod.UID) {
+				return endpoint
+			}
+			continue
+		}
+		for _, address := range endpoint.Addresses {
+			if HasIp(pod, address) {
+				return endpoint
+			}
+		}
+	}
+	return nil
+}
+
+// GetPodsForIp returns the pending or running PODs in the namespace that have the given IP, in either
+// address family, and are not being deleted.
+func GetPodsForIp(client kubernetes.Interface, namespace, ip string) ([]v1.Pod, error) {
+	hasIp := func(pod v1.Pod) bool {
+		return HasIp(pod, ip)
+	}
+	// The status.podIP field selector only matches a POD's primary IP, so fall back to
+	// examining every POD in the namespace for an IP of the other family.
+	pods, err := listActivePods(client, namespace, metaV1.ListOptions{FieldSelector: "status.podIP=" + ip}, hasIp)
+	if err != nil || len(pods) > 0 {
+		return pods, err
+	}
+	return listActivePods(client, namespace, metaV1.ListOptions{}, hasIp)
+}
+
+// GetPodsForHostname returns the pending or running PODs in the namespace with the given hostname and
+// subdomain that are not being deleted.
+func GetPodsForHostname(client kubernetes.Interface, namespace, hostname, subdomain string) ([]v1.Pod, error) {
+	return listActivePods(client, namespace, metaV1.ListOptions{}, func(pod v1.Pod) bool {
+		return pod.Spec.Hostname == hostname && pod.Spec.Subdomain == subdomain
+	})
+}
+
+// GetPodsForService returns the pending or running PODs selected by the Service that are not being
+// deleted. A Service without a selector selects no PODs.
+func GetPodsForService(client kubernetes.Interface, service v1.Service) ([]v1.Pod, error) {
+	if len(service.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	selector := labels.Set(service.Spec.Selector).AsSelectorPreValidated()
+	return listActivePods(client, service.Namespace, metaV1.ListOptions{LabelSelector: selector.String()}, func(pod v1.Pod) bool {
+		return selector.Matches(labels.Set(pod.Labels))
+	})
+}
+
+// IsReady returns whether the POD's Ready condition is true.
+func IsReady(pod v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func listActivePods(client kubernetes.Interface, namespace string, listOptions metaV1.ListOptions, match func(v1.Pod) bool) ([]v1.Pod, error) {
+	podList, err := client.CoreV1().Pods(namespace).List(context.TODO(), listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]v1.Pod, 0, 1)
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		if !match(pod) {
+			continue
+		}
+		filtered = append(filtered, pod)
+	}
+	return filtered, nil
+}
+
+// PodIps returns the IPs of a POD, in all of its address families.
+func PodIps(pod v1.Pod) []string {
+	if len(pod.Status.PodIPs) == 0 {
+		if pod.Status.PodIP == "" {
+			return nil
+		}
+		return []string{pod.Status.PodIP}
+	}
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIp := range pod.Status.PodIPs {
+		ips = append(ips, podIp.IP)
+	}
+	return ips
+}
+
+// HasIp reports whether the given IP is one of the POD's IPs.
+func HasIp(pod v1.Pod, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, podIp := range PodIps(pod) {
+		if parsed.Equal(net.ParseIP(podIp)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipToName returns the label that POD DNS names use for an IP: an IPv4 address with its dots
+// replaced by dashes or an IPv6 address with its colons replaced by dashes.
 func ipToName(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return strings.Replace(parsed.String(), ":", "-", -1)
+	}
 	return strings.Replace(ip, ".", "-", -1)
 }
 
@@ -4,9 +4,18 @@ import (
 	"github.com/proofpoint/kapprover/podnames"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"net"
 	"testing"
 )
@@ -348,6 +357,773 @@ func TestGetNamesForPodAndNamespace(t *testing.T) {
 	}
 }
 
+func TestGetNamesForPodEndpointSlices(t *testing.T) {
+	ready := true
+	notReady := false
+	manualService := makeService(func(service *v1.Service) {
+		service.Name = "manual-service"
+		service.Spec.Selector = nil
+		service.Spec.Type = v1.ServiceTypeClusterIP
+		service.Spec.ClusterIP = "10.0.0.2"
+		service.Spec.ExternalIPs = nil
+	})
+
+	for _, testcase := range []struct {
+		name           string
+		options        podnames.Options
+		endpoints      []discovery.Endpoint
+		serviceName    string
+		expectDnsnames []string
+		expectIps      []string
+	}{
+		{
+			name:           "Disabled",
+			endpoints:      []discovery.Endpoint{{Addresses: []string{"172.1.0.3"}}},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local"},
+			expectIps:      []string{"172.1.0.3"},
+		},
+		{
+			name:      "ByAddress",
+			options:   podnames.Options{EndpointSlices: true},
+			endpoints: []discovery.Endpoint{{Addresses: []string{"172.1.0.9"}}, {Addresses: []string{"172.1.0.3"}}},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"manual-service.somenamespace.svc.cluster.local",
+			},
+			expectIps: []string{"172.1.0.3", "10.0.0.2"},
+		},
+		{
+			name:    "ByTargetRef",
+			options: podnames.Options{EndpointSlices: true, AllowUnqualified: true},
+			endpoints: []discovery.Endpoint{{
+				Addresses: []string{"172.1.0.9"},
+				TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: "somenamespace", Name: "tls-app-579f7cd745-t6fdg"},
+			}},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"manual-service.somenamespace.svc.cluster.local",
+				"manual-service.somenamespace.svc",
+			},
+			expectIps: []string{"172.1.0.3", "10.0.0.2"},
+		},
+		{
+			name:    "TargetRefOtherPod",
+			options: podnames.Options{EndpointSlices: true},
+			endpoints: []discovery.Endpoint{{
+				Addresses: []string{"172.1.0.3"},
+				TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: "somenamespace", Name: "other-pod"},
+			}},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local"},
+			expectIps:      []string{"172.1.0.3"},
+		},
+		{
+			name:           "Ready",
+			options:        podnames.Options{EndpointSlices: true},
+			endpoints:      []discovery.Endpoint{{Addresses: []string{"172.1.0.3"}, Conditions: discovery.EndpointConditions{Ready: &ready}}},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local", "manual-service.somenamespace.svc.cluster.local"},
+			expectIps:      []string{"172.1.0.3", "10.0.0.2"},
+		},
+		{
+			name:           "NotReady",
+			options:        podnames.Options{EndpointSlices: true},
+			endpoints:      []discovery.Endpoint{{Addresses: []string{"172.1.0.3"}, Conditions: discovery.EndpointConditions{Ready: &notReady}}},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local"},
+			expectIps:      []string{"172.1.0.3"},
+		},
+		{
+			name:           "NotReadyPermitted",
+			options:        podnames.Options{EndpointSlices: true, NotReadyEndpoints: true},
+			endpoints:      []discovery.Endpoint{{Addresses: []string{"172.1.0.3"}, Conditions: discovery.EndpointConditions{Ready: &notReady}}},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local", "manual-service.somenamespace.svc.cluster.local"},
+			expectIps:      []string{"172.1.0.3", "10.0.0.2"},
+		},
+		{
+			name:           "NoSuchService",
+			options:        podnames.Options{EndpointSlices: true},
+			serviceName:    "deleted-service",
+			endpoints:      []discovery.Endpoint{{Addresses: []string{"172.1.0.3"}}},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local"},
+			expectIps:      []string{"172.1.0.3"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			serviceName := testcase.serviceName
+			if serviceName == "" {
+				serviceName = "manual-service"
+			}
+			slice := discovery.EndpointSlice{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      serviceName + "-abcde",
+					Namespace: "somenamespace",
+					Labels:    map[string]string{discovery.LabelServiceName: serviceName},
+				},
+				AddressType: discovery.AddressTypeIPv4,
+				Endpoints:   testcase.endpoints,
+			}
+			client := fake.NewSimpleClientset(manualService, &slice)
+
+			options := testcase.options
+			options.ClusterDomain = "cluster.local"
+			dnsnames, ips, err := podnames.GetNamesForPodWithOptions(client, makePod(), options)
+			assert.NoError(t, err, "Error")
+			assert.ElementsMatch(t, testcase.expectDnsnames, dnsnames, "Dnsnames")
+			assert.ElementsMatch(t, parseIps(testcase.expectIps), ips, "Ips")
+		})
+	}
+}
+
+func TestGetNamesForPodHeadless(t *testing.T) {
+	hostname := "web-0"
+	headlessService := makeService(func(service *v1.Service) {
+		service.Name = "web"
+		service.Spec.Type = v1.ServiceTypeClusterIP
+		service.Spec.ClusterIP = v1.ClusterIPNone
+		service.Spec.ExternalIPs = nil
+	})
+
+	for _, testcase := range []struct {
+		name           string
+		options        podnames.Options
+		setupPod       func(pod *v1.Pod)
+		objects        []runtime.Object
+		expectDnsnames []string
+	}{
+		{
+			name:    "NoHostname",
+			objects: []runtime.Object{headlessService},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"172-1-0-3.web.somenamespace.svc.cluster.local",
+				"web.somenamespace.svc.cluster.local",
+			},
+		},
+		{
+			name: "StatefulSet",
+			setupPod: func(pod *v1.Pod) {
+				pod.Spec.Hostname = "web-0"
+				pod.Spec.Subdomain = "web"
+			},
+			objects: []runtime.Object{headlessService},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"web-0.web.somenamespace.svc.cluster.local",
+				"172-1-0-3.web.somenamespace.svc.cluster.local",
+				"web.somenamespace.svc.cluster.local",
+			},
+		},
+		{
+			name:    "StatefulSetUnqualified",
+			options: podnames.Options{AllowUnqualified: true},
+			setupPod: func(pod *v1.Pod) {
+				pod.Spec.Hostname = "web-0"
+				pod.Spec.Subdomain = "web"
+			},
+			objects: []runtime.Object{headlessService},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"web-0.web.somenamespace.svc.cluster.local",
+				"web-0.web.somenamespace.svc",
+				"172-1-0-3.web.somenamespace.svc.cluster.local",
+				"172-1-0-3.web.somenamespace.svc",
+				"web.somenamespace.svc.cluster.local",
+				"web.somenamespace.svc",
+			},
+		},
+		{
+			name:    "OmitHeadlessServiceNames",
+			options: podnames.Options{OmitHeadlessServiceNames: true},
+			setupPod: func(pod *v1.Pod) {
+				pod.Spec.Hostname = "web-0"
+				pod.Spec.Subdomain = "web"
+			},
+			objects: []runtime.Object{headlessService, makeService(func(service *v1.Service) {})},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"web-0.web.somenamespace.svc.cluster.local",
+				"172-1-0-3.web.somenamespace.svc.cluster.local",
+				"tls-service.somenamespace.svc.cluster.local",
+			},
+		},
+		{
+			name:    "OtherSubdomain",
+			options: podnames.Options{OmitHeadlessServiceNames: true},
+			setupPod: func(pod *v1.Pod) {
+				pod.Spec.Hostname = "web-0"
+				pod.Spec.Subdomain = "other"
+			},
+			objects: []runtime.Object{headlessService},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"web-0.other.somenamespace.svc.cluster.local",
+				"172-1-0-3.web.somenamespace.svc.cluster.local",
+			},
+		},
+		{
+			name:    "EndpointSliceHostname",
+			options: podnames.Options{EndpointSlices: true, OmitHeadlessServiceNames: true},
+			objects: []runtime.Object{
+				makeService(func(service *v1.Service) {
+					service.Name = "web"
+					service.Spec.Selector = nil
+					service.Spec.Type = v1.ServiceTypeClusterIP
+					service.Spec.ClusterIP = v1.ClusterIPNone
+					service.Spec.ExternalIPs = nil
+				}),
+				&discovery.EndpointSlice{
+					ObjectMeta: metaV1.ObjectMeta{
+						Name:      "web-abcde",
+						Namespace: "somenamespace",
+						Labels:    map[string]string{discovery.LabelServiceName: "web"},
+					},
+					AddressType: discovery.AddressTypeIPv4,
+					Endpoints: []discovery.Endpoint{{
+						Addresses: []string{"172.1.0.3"},
+						Hostname:  &hostname,
+					}},
+				},
+			},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"web-0.web.somenamespace.svc.cluster.local",
+				"172-1-0-3.web.somenamespace.svc.cluster.local",
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			pod := makePod()
+			if testcase.setupPod != nil {
+				testcase.setupPod(&pod)
+			}
+			client := fake.NewSimpleClientset(testcase.objects...)
+
+			options := testcase.options
+			options.ClusterDomain = "cluster.local"
+			dnsnames, _, err := podnames.GetNamesForPodWithOptions(client, pod, options)
+			assert.NoError(t, err, "Error")
+			assert.ElementsMatch(t, testcase.expectDnsnames, dnsnames, "Dnsnames")
+		})
+	}
+}
+
+func TestGetNamesForPodDualStack(t *testing.T) {
+	pod := makePod()
+	pod.Status.PodIPs = []v1.PodIP{{IP: "172.1.0.3"}, {IP: "fd00:10:244::3"}}
+	dualStackService := makeService(func(service *v1.Service) {
+		service.Spec.ClusterIPs = []string{"10.0.0.1", "fd00:10:96::1"}
+		service.Spec.ExternalIPs = nil
+	})
+	headlessService := makeService(func(service *v1.Service) {
+		service.Name = "web"
+		service.Spec.Type = v1.ServiceTypeClusterIP
+		service.Spec.ClusterIP = v1.ClusterIPNone
+		service.Spec.ClusterIPs = []string{v1.ClusterIPNone}
+		service.Spec.ExternalIPs = nil
+	})
+	manualService := makeService(func(service *v1.Service) {
+		service.Name = "manual-service"
+		service.Spec.Selector = nil
+		service.Spec.Type = v1.ServiceTypeClusterIP
+		service.Spec.ClusterIP = "fd00:10:96::2"
+		service.Spec.ExternalIPs = nil
+	})
+	slice := discovery.EndpointSlice{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "manual-service-abcde",
+			Namespace: "somenamespace",
+			Labels:    map[string]string{discovery.LabelServiceName: "manual-service"},
+		},
+		AddressType: discovery.AddressTypeIPv6,
+		Endpoints:   []discovery.Endpoint{{Addresses: []string{"fd00:10:244::3"}}},
+	}
+	client := fake.NewSimpleClientset(dualStackService, headlessService, manualService, &slice)
+
+	dnsnames, ips, err := podnames.GetNamesForPodWithOptions(client, pod, podnames.Options{ClusterDomain: "cluster.local", EndpointSlices: true})
+	assert.NoError(t, err, "Error")
+	assert.ElementsMatch(t, []string{
+		"172-1-0-3.somenamespace.pod.cluster.local",
+		"fd00-10-244--3.somenamespace.pod.cluster.local",
+		"tls-service.somenamespace.svc.cluster.local",
+		"172-1-0-3.web.somenamespace.svc.cluster.local",
+		"fd00-10-244--3.web.somenamespace.svc.cluster.local",
+		"web.somenamespace.svc.cluster.local",
+		"manual-service.somenamespace.svc.cluster.local",
+	}, dnsnames, "Dnsnames")
+	assert.ElementsMatch(t, parseIps([]string{"172.1.0.3", "fd00:10:244::3", "10.0.0.1", "fd00:10:96::1", "fd00:10:96::2"}), ips, "Ips")
+}
+
+func TestGetPodsForIp(t *testing.T) {
+	nowTime := metaV1.Now()
+	pod := makePod()
+	pod.Status.Phase = v1.PodRunning
+	pod.Status.PodIPs = []v1.PodIP{{IP: "172.1.0.3"}, {IP: "fd00:10:244::3"}}
+	deleted := makePod()
+	deleted.Name = "deleted"
+	deleted.DeletionTimestamp = &nowTime
+	deleted.Status.Phase = v1.PodRunning
+	succeeded := makePod()
+	succeeded.Name = "succeeded"
+	succeeded.Status.Phase = v1.PodSucceeded
+	other := makePod()
+	other.Name = "other"
+	other.Status.Phase = v1.PodPending
+	other.Status.PodIP = "fd00:10:244::4"
+	client := fake.NewSimpleClientset(&pod, &deleted, &succeeded, &other)
+
+	for ip, expectPods := range map[string][]string{
+		"172.1.0.3":      {"tls-app-579f7cd745-t6fdg"},
+		"fd00:10:244::3": {"tls-app-579f7cd745-t6fdg"},
+		"fd00:10:244::4": {"other"},
+		"172.1.0.4":      {},
+	} {
+		pods, err := podnames.GetPodsForIp(client, "somenamespace", ip)
+		assert.NoError(t, err, ip)
+		names := []string{}
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		assert.ElementsMatch(t, expectPods, names, ip)
+	}
+}
+
+func TestGetPodsForService(t *testing.T) {
+	pod := makePod()
+	pod.Status.Phase = v1.PodRunning
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	notReady := makePod()
+	notReady.Name = "notready"
+	notReady.Status.Phase = v1.PodPending
+	succeeded := makePod()
+	succeeded.Name = "succeeded"
+	succeeded.Status.Phase = v1.PodSucceeded
+	other := makePod()
+	other.Name = "other"
+	other.Labels = map[string]string{"app": "other-app"}
+	other.Status.Phase = v1.PodRunning
+	client := fake.NewSimpleClientset(&pod, &notReady, &succeeded, &other)
+
+	pods, err := podnames.GetPodsForService(client, *makeService(func(service *v1.Service) {}))
+	assert.NoError(t, err)
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	assert.ElementsMatch(t, []string{"tls-app-579f7cd745-t6fdg", "notready"}, names)
+
+	assert.True(t, podnames.IsReady(pod), "IsReady")
+	assert.False(t, podnames.IsReady(notReady), "IsReady")
+
+	pods, err = podnames.GetPodsForService(client, *makeService(func(service *v1.Service) {
+		service.Spec.Selector = nil
+	}))
+	assert.NoError(t, err)
+	assert.Empty(t, pods, "Service without a selector")
+}
+
+func TestGetNamesForPodLoadBalancer(t *testing.T) {
+	for _, testcase := range []struct {
+		name           string
+		options        podnames.Options
+		annotations    map[string]string
+		expectDnsnames []string
+		expectIps      []string
+	}{
+		{
+			name:           "Disabled",
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local", "tls-service.somenamespace.svc.cluster.local"},
+			expectIps:      []string{"172.1.0.3", "10.0.0.1"},
+		},
+		{
+			name:    "Enabled",
+			options: podnames.Options{LoadBalancerIngress: true},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"tls-service.somenamespace.svc.cluster.local",
+				"a1b2c3.elb.example.com",
+			},
+			expectIps: []string{"172.1.0.3", "10.0.0.1", "192.0.2.1", "2001:db8::1"},
+		},
+		{
+			name:           "NotAnnotated",
+			options:        podnames.Options{LoadBalancerIngress: true, LoadBalancerAnnotation: "example.com/cert-names"},
+			annotations:    map[string]string{"example.com/cert-names": "yes"},
+			expectDnsnames: []string{"172-1-0-3.somenamespace.pod.cluster.local", "tls-service.somenamespace.svc.cluster.local"},
+			expectIps:      []string{"172.1.0.3", "10.0.0.1"},
+		},
+		{
+			name:        "Annotated",
+			options:     podnames.Options{LoadBalancerIngress: true, LoadBalancerAnnotation: "example.com/cert-names"},
+			annotations: map[string]string{"example.com/cert-names": "true"},
+			expectDnsnames: []string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"tls-service.somenamespace.svc.cluster.local",
+				"a1b2c3.elb.example.com",
+			},
+			expectIps: []string{"172.1.0.3", "10.0.0.1", "192.0.2.1", "2001:db8::1"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(makeService(func(service *v1.Service) {
+				service.Annotations = testcase.annotations
+				service.Spec.ExternalIPs = nil
+				service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{
+					{IP: "192.0.2.1"},
+					{IP: "2001:db8::1"},
+					{Hostname: "a1b2c3.elb.example.com"},
+				}
+			}))
+
+			options := testcase.options
+			options.ClusterDomain = "cluster.local"
+			dnsnames, ips, err := podnames.GetNamesForPodWithOptions(client, makePod(), options)
+			assert.NoError(t, err, "Error")
+			assert.ElementsMatch(t, testcase.expectDnsnames, dnsnames, "Dnsnames")
+			assert.ElementsMatch(t, parseIps(testcase.expectIps), ips, "Ips")
+		})
+	}
+}
+
+func TestGetNamesForPodIngresses(t *testing.T) {
+	otherService := makeService(func(service *v1.Service) {
+		service.Name = "other-service"
+		service.Spec.Selector = map[string]string{"app": "other-app"}
+		service.Spec.ExternalIPs = nil
+	})
+	tlsService := makeService(func(service *v1.Service) {
+		service.Spec.ExternalIPs = nil
+	})
+	suffixes := map[string][]string{
+		"somenamespace": {".team-a.example.com", "team-a.example.com"},
+		"*":             {"shared.example.com"},
+	}
+
+	for _, testcase := range []struct {
+		name           string
+		options        podnames.Options
+		ingress        networking.IngressSpec
+		expectDnsnames []string
+	}{
+		{
+			name:    "Disabled",
+			options: podnames.Options{HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				DefaultBackend: &networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+				TLS:            []networking.IngressTLS{{Hosts: []string{"app.team-a.example.com"}}},
+			},
+		},
+		{
+			name:    "DefaultBackend",
+			options: podnames.Options{Ingresses: true, HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				DefaultBackend: &networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+				TLS:            []networking.IngressTLS{{Hosts: []string{"App.Team-A.example.com", "team-a.example.com", "shared.example.com"}}},
+			},
+			expectDnsnames: []string{"App.Team-A.example.com", "team-a.example.com", "shared.example.com"},
+		},
+		{
+			name:    "RuleBackend",
+			options: podnames.Options{Ingresses: true, HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				Rules: []networking.IngressRule{
+					{Host: "www.team-a.example.com"},
+					{
+						Host: "api.team-a.example.com",
+						IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{
+								{Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "other-service"}}},
+								{Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}}},
+							},
+						}},
+					},
+				},
+			},
+			expectDnsnames: []string{"api.team-a.example.com"},
+		},
+		{
+			name:    "MultiRule",
+			options: podnames.Options{Ingresses: true, HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				Rules: []networking.IngressRule{
+					{
+						Host: "a.team-a.example.com",
+						IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{
+								{Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}}},
+							},
+						}},
+					},
+					{
+						Host: "b.team-a.example.com",
+						IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{
+								{Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "other-service"}}},
+							},
+						}},
+					},
+				},
+				TLS: []networking.IngressTLS{{Hosts: []string{"A.team-a.example.com", "b.team-a.example.com", "c.team-a.example.com"}}},
+			},
+			expectDnsnames: []string{"a.team-a.example.com", "A.team-a.example.com"},
+		},
+		{
+			name:    "MultiRuleDefaultBackend",
+			options: podnames.Options{Ingresses: true, HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				DefaultBackend: &networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+				Rules: []networking.IngressRule{
+					{
+						Host: "b.team-a.example.com",
+						IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{
+								{Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "other-service"}}},
+							},
+						}},
+					},
+				},
+				TLS: []networking.IngressTLS{{Hosts: []string{"b.team-a.example.com", "c.team-a.example.com"}}},
+			},
+			expectDnsnames: []string{"b.team-a.example.com", "c.team-a.example.com"},
+		},
+		{
+			name:    "OtherService",
+			options: podnames.Options{Ingresses: true, HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				DefaultBackend: &networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "other-service"}},
+				TLS:            []networking.IngressTLS{{Hosts: []string{"app.team-a.example.com"}}},
+			},
+		},
+		{
+			name:    "NotInSuffixes",
+			options: podnames.Options{Ingresses: true, HostnameSuffixes: suffixes},
+			ingress: networking.IngressSpec{
+				DefaultBackend: &networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "tls-service"}},
+				TLS:            []networking.IngressTLS{{Hosts: []string{"app.team-b.example.com", "evilteam-a.example.com", "app.shared.example.com"}}},
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			ingress := networking.Ingress{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      "tls-ingress",
+					Namespace: "somenamespace",
+				},
+				Spec: testcase.ingress,
+			}
+			client := fake.NewSimpleClientset(tlsService, otherService, &ingress)
+
+			options := testcase.options
+			options.ClusterDomain = "cluster.local"
+			dnsnames, _, err := podnames.GetNamesForPodWithOptions(client, makePod(), options)
+			assert.NoError(t, err, "Error")
+			expectDnsnames := append([]string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"tls-service.somenamespace.svc.cluster.local",
+			}, testcase.expectDnsnames...)
+			assert.ElementsMatch(t, expectDnsnames, dnsnames, "Dnsnames")
+		})
+	}
+}
+
+func TestGetNamesForPodExternalDNS(t *testing.T) {
+	suffixes := map[string][]string{"somenamespace": {".team-a.example.com"}}
+	for _, testcase := range []struct {
+		name           string
+		options        podnames.Options
+		annotations    map[string]string
+		expectDnsnames []string
+	}{
+		{
+			name:        "Disabled",
+			options:     podnames.Options{HostnameSuffixes: suffixes},
+			annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "app.team-a.example.com"},
+		},
+		{
+			name:           "Annotation",
+			options:        podnames.Options{ExternalDNSAnnotation: "external-dns.alpha.kubernetes.io/hostname", HostnameSuffixes: suffixes},
+			annotations:    map[string]string{"external-dns.alpha.kubernetes.io/hostname": " app.team-a.example.com,,api.team-a.example.com ,app.team-b.example.com"},
+			expectDnsnames: []string{"app.team-a.example.com", "api.team-a.example.com"},
+		},
+		{
+			name:        "OtherAnnotation",
+			options:     podnames.Options{ExternalDNSAnnotation: "example.com/hostnames", HostnameSuffixes: suffixes},
+			annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "app.team-a.example.com"},
+		},
+		{
+			name:        "NoSuffixes",
+			options:     podnames.Options{ExternalDNSAnnotation: "external-dns.alpha.kubernetes.io/hostname"},
+			annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "app.team-a.example.com"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(makeService(func(service *v1.Service) {
+				service.Annotations = testcase.annotations
+				service.Spec.ExternalIPs = nil
+			}))
+
+			options := testcase.options
+			options.ClusterDomain = "cluster.local"
+			dnsnames, _, err := podnames.GetNamesForPodWithOptions(client, makePod(), options)
+			assert.NoError(t, err, "Error")
+			expectDnsnames := append([]string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"tls-service.somenamespace.svc.cluster.local",
+			}, testcase.expectDnsnames...)
+			assert.ElementsMatch(t, expectDnsnames, dnsnames, "Dnsnames")
+		})
+	}
+}
+
+// dynamicClientset is a fake client that can also read custom resources.
+type dynamicClientset struct {
+	*fake.Clientset
+	dynamic dynamic.Interface
+}
+
+func (c *dynamicClientset) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
+
+func TestGetNamesForPodClusterSet(t *testing.T) {
+	serviceExport := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "multicluster.x-k8s.io/v1alpha1",
+		"kind":       "ServiceExport",
+		"metadata": map[string]interface{}{
+			"name":      "tls-service",
+			"namespace": "somenamespace",
+		},
+	}}
+	otherExport := serviceExport.DeepCopy()
+	otherExport.SetNamespace("othernamespace")
+	services := []runtime.Object{
+		makeService(func(service *v1.Service) {
+			service.Spec.ExternalIPs = nil
+		}),
+		makeService(func(service *v1.Service) {
+			service.Name = "other-service"
+			service.Spec.ExternalIPs = nil
+		}),
+	}
+	crdMissing := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	crdMissing.PrependReactor("get", "serviceexports", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewNotFound(schema.GroupResource{Group: "multicluster.x-k8s.io", Resource: "serviceexports"}, "tls-service")
+	})
+	forbidden := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	forbidden.PrependReactor("get", "serviceexports", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Group: "multicluster.x-k8s.io", Resource: "serviceexports"}, "tls-service", nil)
+	})
+
+	for _, testcase := range []struct {
+		name             string
+		clusterSetDomain string
+		dynamic          dynamic.Interface
+		expectDnsnames   []string
+		expectErr        string
+	}{
+		{
+			name:    "Disabled",
+			dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), serviceExport),
+		},
+		{
+			name:             "Exported",
+			clusterSetDomain: "clusterset.local",
+			dynamic:          dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), serviceExport, otherExport),
+			expectDnsnames:   []string{"tls-service.somenamespace.svc.clusterset.local"},
+		},
+		{
+			name:             "NotExported",
+			clusterSetDomain: "clusterset.local",
+			dynamic:          dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), otherExport),
+		},
+		{
+			name:             "CrdMissing",
+			clusterSetDomain: "clusterset.local",
+			dynamic:          crdMissing,
+		},
+		{
+			name:             "NoDynamicClient",
+			clusterSetDomain: "clusterset.local",
+		},
+		{
+			name:             "Forbidden",
+			clusterSetDomain: "clusterset.local",
+			dynamic:          forbidden,
+			expectErr:        "serviceexports.multicluster.x-k8s.io \"tls-service\" is forbidden: <nil>",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var client kubernetes.Interface = fake.NewSimpleClientset(services...)
+			if testcase.dynamic != nil {
+				client = &dynamicClientset{Clientset: client.(*fake.Clientset), dynamic: testcase.dynamic}
+			}
+
+			options := podnames.Options{ClusterDomain: "cluster.local", ClusterSetDomain: testcase.clusterSetDomain}
+			dnsnames, _, err := podnames.GetNamesForPodWithOptions(client, makePod(), options)
+			if testcase.expectErr != "" {
+				assert.EqualError(t, err, testcase.expectErr, "Error")
+				return
+			}
+			assert.NoError(t, err, "Error")
+			expectDnsnames := append([]string{
+				"172-1-0-3.somenamespace.pod.cluster.local",
+				"tls-service.somenamespace.svc.cluster.local",
+				"other-service.somenamespace.svc.cluster.local",
+			}, testcase.expectDnsnames...)
+			assert.ElementsMatch(t, expectDnsnames, dnsnames, "Dnsnames")
+		})
+	}
+}
+
+func TestGetNamesForPodClusterDomainAliases(t *testing.T) {
+	pod := makePod()
+	pod.Spec.Hostname = "somehostname"
+	pod.Spec.Subdomain = "somesubdomain"
+	client := fake.NewSimpleClientset(makeService(func(service *v1.Service) {
+		service.Spec.ExternalIPs = nil
+	}))
+
+	dnsnames, _, err := podnames.GetNamesForPodWithOptions(client, pod, podnames.Options{
+		ClusterDomain:        "cluster.local",
+		ClusterDomainAliases: []string{"old.example.com"},
+		AllowUnqualified:     true,
+	})
+	assert.NoError(t, err, "Error")
+	assert.ElementsMatch(t, []string{
+		"172-1-0-3.somenamespace.pod.cluster.local",
+		"172-1-0-3.somenamespace.pod.old.example.com",
+		"somehostname.somesubdomain.somenamespace.svc.cluster.local",
+		"somehostname.somesubdomain.somenamespace.svc.old.example.com",
+		"somehostname.somesubdomain.somenamespace.svc",
+		"tls-service.somenamespace.svc.cluster.local",
+		"tls-service.somenamespace.svc.old.example.com",
+		"tls-service.somenamespace.svc",
+	}, dnsnames, "Dnsnames")
+}
+
+func makePod() v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "tls-app-579f7cd745-t6fdg",
+			Namespace: "somenamespace",
+			Labels: map[string]string{
+				"app": "some-app",
+			},
+		},
+		Spec: v1.PodSpec{
+			ServiceAccountName: "someserviceaccount",
+		},
+		Status: v1.PodStatus{
+			PodIP: "172.1.0.3",
+		},
+	}
+}
+
+func parseIps(ips []string) []net.IP {
+	parsed := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		parsed = append(parsed, net.ParseIP(ip))
+	}
+	return parsed
+}
+
 func makeService(setupService func(service *v1.Service)) *v1.Service {
 	service := v1.Service{
 		ObjectMeta: metaV1.ObjectMeta{
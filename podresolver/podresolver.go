@@ -0,0 +1,267 @@
+package podresolver
+
+import (
+	"crypto/x509"
+	"fmt"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/podnames"
+	"github.com/proofpoint/kapprover/san"
+	"github.com/sirupsen/logrus"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	resolvers = make(map[string]Resolver)
+	resolverM sync.RWMutex
+)
+
+func init() {
+	Register("podip", &podIpResolver{})
+	Register("hostname", &hostnameResolver{})
+	Register("san", &sanResolver{})
+}
+
+// Resolver maps a certificate request to the POD it is for under one scheme of naming PODs.
+// If the request does not name a POD in the resolver's scheme, it returns named false and a
+// message saying why. Otherwise it returns the POD or a message to take adverse action.
+type Resolver interface {
+	Resolve(client kubernetes.Interface, request *certificates.CertificateSigningRequest, certificateRequest *x509.CertificateRequest, clusterDomains []string) (pod *v1.Pod, named bool, message string, err error)
+}
+
+// Register makes a Resolver available by the provided name.
+//
+// If called twice with the same name or if the provided Resolver is nil, this function panics.
+func Register(name string, resolver Resolver) {
+	resolverM.Lock()
+	defer resolverM.Unlock()
+
+	if resolver == nil {
+		panic("podresolver: Register resolver is nil")
+	}
+
+	if _, dup := resolvers[name]; dup {
+		panic("podresolver: Register called twice for resolver " + name)
+	}
+
+	resolvers[name] = resolver
+}
+
+// Get returns the Resolver registered by the provided name.
+func Get(name string) (Resolver, bool) {
+	resolverM.RLock()
+	defer resolverM.RUnlock()
+
+	resolver, exists := resolvers[name]
+	return resolver, exists
+}
+
+// List returns the names of the registered resolvers, sorted.
+func List() []string {
+	resolverM.RLock()
+	defer resolverM.RUnlock()
+
+	names := make([]string, 0, len(resolvers))
+	for name := range resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the registered resolvers with the provided names.
+func Lookup(names []string) ([]Resolver, error) {
+	ret := make([]Resolver, 0, len(names))
+	for _, name := range names {
+		resolver, exists := Get(name)
+		if !exists {
+			return nil, fmt.Errorf("unsupported scheme %q, registered schemes: %s", name, strings.Join(List(), ","))
+		}
+		ret = append(ret, resolver)
+	}
+	return ret, nil
+}
+
+// Resolve returns the POD that a certificate request is for under the first of the resolvers in
+// whose scheme the request names a POD, or the podip resolver if resolvers is nil. If the request
+// names a POD in none of them, the message is that of the first resolver.
+func Resolve(resolvers []Resolver, client kubernetes.Interface, request *certificates.CertificateSigningRequest, certificateRequest *x509.CertificateRequest, clusterDomains []string) (pod *v1.Pod, rejectMessage string, err error) {
+	if resolvers == nil {
+		resolvers = []Resolver{&podIpResolver{}}
+	}
+	for i, resolver := range resolvers {
+		pod, named, message, err := resolver.Resolve(client, request, certificateRequest, clusterDomains)
+		if err != nil || named {
+			return pod, message, err
+		}
+		if i == 0 {
+			rejectMessage = message
+		}
+	}
+	return nil, rejectMessage, nil
+}
+
+// podIpResolver resolves a subject of "<ip>.<namespace>.pod.<cluster-domain>".
+type podIpResolver struct {
+}
+
+func (r *podIpResolver) Resolve(client kubernetes.Interface, request *certificates.CertificateSigningRequest, certificateRequest *x509.CertificateRequest, clusterDomains []string) (*v1.Pod, bool, string, error) {
+	if len(certificateRequest.Subject.Names) > 1 {
+		return nil, true, "Subject has more than one name component", nil
+	}
+	return resolvePodIpName(client, "Subject", certificateRequest.Subject.CommonName, clusterDomains)
+}
+
+// hostnameResolver resolves a subject of "<hostname>.<subdomain>.<namespace>.svc.<cluster-domain>".
+type hostnameResolver struct {
+}
+
+func (r *hostnameResolver) Resolve(client kubernetes.Interface, request *certificates.CertificateSigningRequest, certificateRequest *x509.CertificateRequest, clusterDomains []string) (*v1.Pod, bool, string, error) {
+	if len(certificateRequest.Subject.Names) > 1 {
+		return nil, true, "Subject has more than one name component", nil
+	}
+	return resolveHostnameName(client, "Subject", certificateRequest.Subject.CommonName, clusterDomains)
+}
+
+// sanResolver resolves a request with no subject common name by its first Subject Alt Name, which
+// is either a name in the podip or hostname scheme or an IP of a POD in the requesting service
+// account's namespace.
+type sanResolver struct {
+}
+
+func (r *sanResolver) Resolve(client kubernetes.Interface, request *certificates.CertificateSigningRequest, certificateRequest *x509.CertificateRequest, clusterDomains []string) (*v1.Pod, bool, string, error) {
+	if certificateRequest.Subject.CommonName != "" {
+		return nil, false, fmt.Sprintf("Subject %q is not empty", certificateRequest.Subject.CommonName), nil
+	}
+	if len(certificateRequest.Subject.Names) != 0 {
+		return nil, true, "Subject has a name component but no common name", nil
+	}
+
+	names, msg := san.Parse(certificateRequest)
+	if msg != "" {
+		return nil, true, msg, nil
+	}
+	if len(names) == 0 {
+		return nil, true, "Subject is empty and there are no Subject Alt Names", nil
+	}
+
+	first := names[0]
+	switch first.Type {
+	case san.DNS:
+		pod, named, msg, err := resolvePodIpName(client, "Subject Alt Name", first.DNSName, clusterDomains)
+		if named || err != nil {
+			return pod, named, msg, err
+		}
+		pod, named, msg, err = resolveHostnameName(client, "Subject Alt Name", first.DNSName, clusterDomains)
+		if named || err != nil {
+			return pod, named, msg, err
+		}
+		return nil, true, fmt.Sprintf("Subject Alt Name %q is not a POD name", first.DNSName), nil
+	case san.IP:
+		namespace := serviceAccountNamespace(request.Spec.Username)
+		if namespace == "" {
+			return nil, true, fmt.Sprintf("Requesting user %q is not a service account", request.Spec.Username), nil
+		}
+		pods, err := podnames.GetPodsForIp(client, namespace, first.IP.String())
+		if err != nil {
+			return nil, true, "", err
+		}
+		if len(pods) == 0 {
+			return nil, true, fmt.Sprintf("No pending or running POD in namespace %q with IP %q", namespace, first.IP), nil
+		}
+		pod, msg := choose(pods, "IP", first.IP.String())
+		return pod, true, msg, nil
+	default:
+		return nil, true, fmt.Sprintf("First Subject Alt Name is a %s, not a DNS name or IP address", first.Type), nil
+	}
+}
+
+func resolvePodIpName(client kubernetes.Interface, what, name string, clusterDomains []string) (*v1.Pod, bool, string, error) {
+	labels := splitDomain(name, "pod", clusterDomains)
+	if labels == nil {
+		return nil, false, fmt.Sprintf("%s %q is not in the pod.%s domain", what, name, clusterDomains[0]), nil
+	}
+	if len(labels) != 2 {
+		return nil, true, fmt.Sprintf("%s %q is not a POD-format name", what, name), nil
+	}
+	podIp := csr.PodLabelToIp(labels[0])
+	if podIp == "" {
+		return nil, true, fmt.Sprintf("%s %q is not a POD-format name", what, name), nil
+	}
+	namespace := labels[1]
+
+	pods, err := podnames.GetPodsForIp(client, namespace, podIp)
+	if err != nil {
+		return nil, true, "", err
+	}
+	if len(pods) == 0 {
+		return nil, true, fmt.Sprintf("No pending or running POD in namespace %q with IP %q", namespace, podIp), nil
+	}
+	pod, msg := choose(pods, "IP", podIp)
+	return pod, true, msg, nil
+}
+
+func resolveHostnameName(client kubernetes.Interface, what, name string, clusterDomains []string) (*v1.Pod, bool, string, error) {
+	labels := splitDomain(name, "svc", clusterDomains)
+	if labels == nil {
+		return nil, false, fmt.Sprintf("%s %q is not in the svc.%s domain", what, name, clusterDomains[0]), nil
+	}
+	if len(labels) != 3 || labels[0] == "" || labels[1] == "" || labels[2] == "" {
+		return nil, true, fmt.Sprintf("%s %q is not a POD hostname", what, name), nil
+	}
+	hostname, subdomain, namespace := labels[0], labels[1], labels[2]
+
+	pods, err := podnames.GetPodsForHostname(client, namespace, hostname, subdomain)
+	if err != nil {
+		return nil, true, "", err
+	}
+	if len(pods) == 0 {
+		return nil, true, fmt.Sprintf("No pending or running POD in namespace %q with hostname %q", namespace, hostname+"."+subdomain), nil
+	}
+	pod, msg := choose(pods, "hostname", hostname+"."+subdomain)
+	return pod, true, msg, nil
+}
+
+// splitDomain returns the labels of name before ".<kind>.<cluster-domain>" for the first of the
+// cluster domains that it is in, or nil if it is in none of them.
+func splitDomain(name, kind string, clusterDomains []string) []string {
+	for _, clusterDomain := range clusterDomains {
+		suffix := "." + kind + "." + clusterDomain
+		if strings.HasSuffix(name, suffix) {
+			return strings.Split(strings.TrimSuffix(name, suffix), ".")
+		}
+	}
+	return nil
+}
+
+// choose returns the first of the PODs found, logging if there is more than one. If the PODs
+// differ in namespace or service account, the name is ambiguous and it returns a message to take
+// adverse action instead.
+func choose(pods []v1.Pod, what, value string) (*v1.Pod, string) {
+	if len(pods) > 1 {
+		logrus.Warnf("Found multiple pods for %s %q", what, value)
+		for _, pod := range pods {
+			logrus.Infof("Pod %+v", pod)
+		}
+		for _, pod := range pods[1:] {
+			if pod.Namespace != pods[0].Namespace || pod.Spec.ServiceAccountName != pods[0].Spec.ServiceAccountName {
+				return nil, fmt.Sprintf("Multiple PODs with %s %q run as different service accounts", what, value)
+			}
+		}
+	}
+	return &pods[0], ""
+}
+
+// serviceAccountNamespace returns the namespace of a service account username, or the empty string
+// if the username is not that of a service account.
+func serviceAccountNamespace(username string) string {
+	split := strings.Split(username, ":")
+	if len(split) != 4 || split[0] != "system" || split[1] != "serviceaccount" || split[2] == "" || split[3] == "" {
+		return ""
+	}
+	return split[2]
+}
@@ -0,0 +1,331 @@
+package podresolver_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/proofpoint/kapprover/podresolver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	assert.Equal(t, []string{"hostname", "podip", "san"}, podresolver.List(), "List")
+
+	resolvers, err := podresolver.Lookup([]string{"podip", "san"})
+	assert.NoError(t, err, "Lookup")
+	assert.Len(t, resolvers, 2, "Lookup")
+
+	_, err = podresolver.Lookup([]string{"podip", "unknown"})
+	assert.EqualError(t, err, "unsupported scheme \"unknown\", registered schemes: hostname,podip,san", "Lookup")
+}
+
+func TestResolve(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err, "Generate the key")
+
+	client := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "web-0",
+				Namespace: "somenamespace",
+			},
+			Spec: v1.PodSpec{
+				Hostname:  "web-0",
+				Subdomain: "web",
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				PodIP: "172.1.0.3",
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "done",
+				Namespace: "somenamespace",
+			},
+			Spec: v1.PodSpec{
+				Hostname:  "done",
+				Subdomain: "web",
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodSucceeded,
+				PodIP: "172.1.0.4",
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "reused-a",
+				Namespace: "somenamespace",
+			},
+			Spec: v1.PodSpec{
+				ServiceAccountName: "someserviceaccount",
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				PodIP: "172.1.0.5",
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "reused-b",
+				Namespace: "somenamespace",
+			},
+			Spec: v1.PodSpec{
+				ServiceAccountName: "otherserviceaccount",
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				PodIP: "172.1.0.5",
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "replica-a",
+				Namespace: "somenamespace",
+			},
+			Spec: v1.PodSpec{
+				ServiceAccountName: "someserviceaccount",
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				PodIP: "172.1.0.6",
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "replica-b",
+				Namespace: "somenamespace",
+			},
+			Spec: v1.PodSpec{
+				ServiceAccountName: "someserviceaccount",
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				PodIP: "172.1.0.6",
+			},
+		},
+	)
+
+	for _, testcase := range []struct {
+		name          string
+		schemes       []string
+		username      string
+		commonName    string
+		organization  string
+		dnsNames      []string
+		ips           []net.IP
+		uris          []string
+		expectPod     string
+		expectMessage string
+	}{
+		{
+			name:       "Default",
+			commonName: "172-1-0-3.somenamespace.pod.cluster.local",
+			expectPod:  "web-0",
+		},
+		{
+			name:       "DefaultAlias",
+			commonName: "172-1-0-3.somenamespace.pod.old.example.com",
+			expectPod:  "web-0",
+		},
+		{
+			name:          "DefaultHostname",
+			commonName:    "web-0.web.somenamespace.svc.cluster.local",
+			expectMessage: "Subject \"web-0.web.somenamespace.svc.cluster.local\" is not in the pod.cluster.local domain",
+		},
+		{
+			name:          "PodIpMoreThanOneComponent",
+			schemes:       []string{"podip"},
+			commonName:    "172-1-0-3.somenamespace.pod.cluster.local",
+			organization:  "SomeOrg",
+			expectMessage: "Subject has more than one name component",
+		},
+		{
+			name:          "PodIpExtraComponents",
+			schemes:       []string{"podip"},
+			commonName:    "172-1-0-3.somenamespace.extra.pod.cluster.local",
+			expectMessage: "Subject \"172-1-0-3.somenamespace.extra.pod.cluster.local\" is not a POD-format name",
+		},
+		{
+			name:          "PodIpMissingNamespace",
+			schemes:       []string{"podip"},
+			commonName:    "172-1-0-3.pod.cluster.local",
+			expectMessage: "Subject \"172-1-0-3.pod.cluster.local\" is not a POD-format name",
+		},
+		{
+			name:          "PodIpNotFound",
+			schemes:       []string{"podip", "hostname"},
+			commonName:    "172-1-0-4.somenamespace.pod.cluster.local",
+			expectMessage: "No pending or running POD in namespace \"somenamespace\" with IP \"172.1.0.4\"",
+		},
+		{
+			name:          "PodIpDifferentServiceAccounts",
+			schemes:       []string{"podip"},
+			commonName:    "172-1-0-5.somenamespace.pod.cluster.local",
+			expectMessage: "Multiple PODs with IP \"172.1.0.5\" run as different service accounts",
+		},
+		{
+			name:       "PodIpSameServiceAccount",
+			schemes:    []string{"podip"},
+			commonName: "172-1-0-6.somenamespace.pod.cluster.local",
+			expectPod:  "replica-a",
+		},
+		{
+			name:          "SanIpDifferentServiceAccounts",
+			schemes:       []string{"san"},
+			ips:           []net.IP{net.ParseIP("172.1.0.5")},
+			expectMessage: "Multiple PODs with IP \"172.1.0.5\" run as different service accounts",
+		},
+		{
+			name:       "Hostname",
+			schemes:    []string{"podip", "hostname"},
+			commonName: "web-0.web.somenamespace.svc.cluster.local",
+			expectPod:  "web-0",
+		},
+		{
+			name:          "HostnameNotFound",
+			schemes:       []string{"hostname"},
+			commonName:    "done.web.somenamespace.svc.cluster.local",
+			expectMessage: "No pending or running POD in namespace \"somenamespace\" with hostname \"done.web\"",
+		},
+		{
+			name:          "HostnameServiceName",
+			schemes:       []string{"hostname"},
+			commonName:    "web.somenamespace.svc.cluster.local",
+			expectMessage: "Subject \"web.somenamespace.svc.cluster.local\" is not a POD hostname",
+		},
+		{
+			name:          "NoSchemeMatches",
+			schemes:       []string{"hostname", "podip", "san"},
+			commonName:    "example.com",
+			expectMessage: "Subject \"example.com\" is not in the svc.cluster.local domain",
+		},
+		{
+			name:      "SanPodIp",
+			schemes:   []string{"podip", "san"},
+			dnsNames:  []string{"172-1-0-3.somenamespace.pod.cluster.local", "example.com"},
+			expectPod: "web-0",
+		},
+		{
+			name:      "SanHostname",
+			schemes:   []string{"san"},
+			dnsNames:  []string{"web-0.web.somenamespace.svc.cluster.local"},
+			expectPod: "web-0",
+		},
+		{
+			name:          "SanNotPodName",
+			schemes:       []string{"san"},
+			dnsNames:      []string{"example.com", "172-1-0-3.somenamespace.pod.cluster.local"},
+			expectMessage: "Subject Alt Name \"example.com\" is not a POD name",
+		},
+		{
+			name:          "SanPodIpNotFound",
+			schemes:       []string{"san"},
+			dnsNames:      []string{"172-1-0-4.somenamespace.pod.cluster.local"},
+			expectMessage: "No pending or running POD in namespace \"somenamespace\" with IP \"172.1.0.4\"",
+		},
+		{
+			name:      "SanIp",
+			schemes:   []string{"san"},
+			ips:       []net.IP{net.ParseIP("172.1.0.3")},
+			expectPod: "web-0",
+		},
+		{
+			name:          "SanWithOrganization",
+			schemes:       []string{"san"},
+			organization:  "system:masters",
+			ips:           []net.IP{net.ParseIP("172.1.0.3")},
+			expectMessage: "Subject has a name component but no common name",
+		},
+		{
+			name:          "SanIpOtherNamespace",
+			schemes:       []string{"san"},
+			username:      "system:serviceaccount:othernamespace:someserviceaccount",
+			ips:           []net.IP{net.ParseIP("172.1.0.3")},
+			expectMessage: "No pending or running POD in namespace \"othernamespace\" with IP \"172.1.0.3\"",
+		},
+		{
+			name:          "SanIpNotServiceAccount",
+			schemes:       []string{"san"},
+			username:      "someuser",
+			ips:           []net.IP{net.ParseIP("172.1.0.3")},
+			expectMessage: "Requesting user \"someuser\" is not a service account",
+		},
+		{
+			name:          "SanUri",
+			schemes:       []string{"san"},
+			uris:          []string{"spiffe://cluster.local/ns/somenamespace/sa/someserviceaccount"},
+			expectMessage: "First Subject Alt Name is a URI, not a DNS name or IP address",
+		},
+		{
+			name:          "SanNoNames",
+			schemes:       []string{"san"},
+			expectMessage: "Subject is empty and there are no Subject Alt Names",
+		},
+		{
+			name:          "SanCommonName",
+			schemes:       []string{"san"},
+			commonName:    "172-1-0-3.somenamespace.pod.cluster.local",
+			expectMessage: "Subject \"172-1-0-3.somenamespace.pod.cluster.local\" is not empty",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var resolvers []podresolver.Resolver
+			if testcase.schemes != nil {
+				var err error
+				resolvers, err = podresolver.Lookup(testcase.schemes)
+				require.NoError(t, err, "Lookup")
+			}
+
+			certificateRequestTemplate := x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: testcase.commonName,
+				},
+				DNSNames:           testcase.dnsNames,
+				IPAddresses:        testcase.ips,
+				SignatureAlgorithm: x509.SHA256WithRSAPSS,
+			}
+			if testcase.organization != "" {
+				certificateRequestTemplate.Subject.Organization = []string{testcase.organization}
+			}
+			for _, uri := range testcase.uris {
+				parsed, err := url.Parse(uri)
+				require.NoError(t, err, "Parse URI")
+				certificateRequestTemplate.URIs = append(certificateRequestTemplate.URIs, parsed)
+			}
+
+			der, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequestTemplate, key)
+			require.NoError(t, err, "Generate the CSR")
+			certificateRequest, err := x509.ParseCertificateRequest(der)
+			require.NoError(t, err, "Parse the CSR")
+
+			username := testcase.username
+			if username == "" {
+				username = "system:serviceaccount:somenamespace:someserviceaccount"
+			}
+			request := certificates.CertificateSigningRequest{
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: username,
+				},
+			}
+
+			pod, msg, err := podresolver.Resolve(resolvers, client, &request, certificateRequest, []string{"cluster.local", "old.example.com"})
+			assert.NoError(t, err, "Error")
+			assert.Equal(t, testcase.expectMessage, msg, "Message")
+			if testcase.expectPod == "" {
+				assert.Nil(t, pod, "Pod")
+			} else if assert.NotNil(t, pod, "Pod") {
+				assert.Equal(t, testcase.expectPod, pod.Name, "Pod")
+			}
+		})
+	}
+}
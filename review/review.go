@@ -0,0 +1,195 @@
+package review
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"github.com/proofpoint/kapprover/csr"
+	"github.com/proofpoint/kapprover/san"
+	certificates "k8s.io/api/certificates/v1beta1"
+)
+
+// Review is the JSON document describing a CSR that is handed to an external policy
+// decision point, such as the webhook and exec inspectors.
+type Review struct {
+	UID                string              `json:"uid"`
+	Name               string              `json:"name"`
+	SignerName         string              `json:"signerName,omitempty"`
+	Username           string              `json:"username"`
+	UserUID            string              `json:"userUID,omitempty"`
+	Groups             []string            `json:"groups,omitempty"`
+	Extra              map[string][]string `json:"extra,omitempty"`
+	Usages             []string            `json:"usages,omitempty"`
+	Request            string              `json:"request"`
+	CertificateRequest CertificateRequest  `json:"certificateRequest"`
+}
+
+// CertificateRequest holds the parsed fields of the PKCS#10 request. SubjectAltNames lists every
+// Subject Alt Name in order; DNSNames, IPAddresses, URIs and EmailAddresses repeat those of the
+// commonly used types.
+type CertificateRequest struct {
+	Subject            Subject          `json:"subject"`
+	SubjectAltNames    []SubjectAltName `json:"subjectAltNames,omitempty"`
+	DNSNames           []string         `json:"dnsNames,omitempty"`
+	IPAddresses        []string         `json:"ipAddresses,omitempty"`
+	URIs               []string         `json:"uris,omitempty"`
+	EmailAddresses     []string         `json:"emailAddresses,omitempty"`
+	SignatureAlgorithm string           `json:"signatureAlgorithm"`
+	PublicKeyAlgorithm string           `json:"publicKeyAlgorithm"`
+	PublicKeyBits      int              `json:"publicKeyBits,omitempty"`
+	Extensions         []Extension      `json:"extensions,omitempty"`
+}
+
+// SubjectAltName is a Subject Alt Name of any type: one of "dns", "ip", "uri", "email",
+// "otherName", "registeredID", "directoryName", "x400Address" or "ediPartyName". Value is the name for DNS names, email
+// addresses, URIs and IP addresses, the UPN of a User Principal Name otherName and the string
+// form of a directoryName. OID is the type-id of an otherName or the identifier of a
+// registeredID. Raw is the complete encoded GeneralName.
+type SubjectAltName struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	OID   string `json:"oid,omitempty"`
+	Raw   []byte `json:"raw"`
+}
+
+// Subject is the subject distinguished name of the request.
+type Subject struct {
+	String             string   `json:"string"`
+	CommonName         string   `json:"commonName,omitempty"`
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+	Country            []string `json:"country,omitempty"`
+	Province           []string `json:"province,omitempty"`
+	Locality           []string `json:"locality,omitempty"`
+}
+
+// Extension is an X.509 extension requested in the CSR.
+type Extension struct {
+	ID       string `json:"id"`
+	Critical bool   `json:"critical,omitempty"`
+}
+
+// Verdict is the decision returned by an external policy decision point.
+// A verdict that is not allowed denies the request with its message.
+type Verdict struct {
+	Allowed bool   `json:"allowed"`
+	Message string `json:"message,omitempty"`
+}
+
+// New builds the Review for a request. If the request or its Subject Alt Names cannot be
+// parsed, it returns a message to take adverse action instead.
+func New(request *certificates.CertificateSigningRequest) (*Review, string) {
+	certificateRequest, msg := csr.Extract(request.Spec.Request)
+	if msg != "" {
+		return nil, msg
+	}
+	names, msg := san.Parse(certificateRequest)
+	if msg != "" {
+		return nil, msg
+	}
+
+	ret := Review{
+		UID:      string(request.UID),
+		Name:     request.Name,
+		Username: request.Spec.Username,
+		UserUID:  request.Spec.UID,
+		Groups:   request.Spec.Groups,
+		Request:  string(request.Spec.Request),
+		CertificateRequest: CertificateRequest{
+			Subject: Subject{
+				String:             certificateRequest.Subject.String(),
+				CommonName:         certificateRequest.Subject.CommonName,
+				Organization:       certificateRequest.Subject.Organization,
+				OrganizationalUnit: certificateRequest.Subject.OrganizationalUnit,
+				Country:            certificateRequest.Subject.Country,
+				Province:           certificateRequest.Subject.Province,
+				Locality:           certificateRequest.Subject.Locality,
+			},
+			SignatureAlgorithm: certificateRequest.SignatureAlgorithm.String(),
+			PublicKeyAlgorithm: certificateRequest.PublicKeyAlgorithm.String(),
+			PublicKeyBits:      publicKeyBits(certificateRequest.PublicKey),
+		},
+	}
+	if request.Spec.SignerName != nil {
+		ret.SignerName = *request.Spec.SignerName
+	}
+	if len(request.Spec.Extra) != 0 {
+		ret.Extra = map[string][]string{}
+		for key, value := range request.Spec.Extra {
+			ret.Extra[key] = value
+		}
+	}
+	for _, usage := range request.Spec.Usages {
+		ret.Usages = append(ret.Usages, string(usage))
+	}
+	for _, name := range names {
+		ret.CertificateRequest.SubjectAltNames = append(ret.CertificateRequest.SubjectAltNames, subjectAltName(name))
+		switch name.Type {
+		case san.DNS:
+			ret.CertificateRequest.DNSNames = append(ret.CertificateRequest.DNSNames, name.DNSName)
+		case san.IP:
+			ret.CertificateRequest.IPAddresses = append(ret.CertificateRequest.IPAddresses, name.IP.String())
+		case san.URI:
+			ret.CertificateRequest.URIs = append(ret.CertificateRequest.URIs, name.URI)
+		case san.Email:
+			ret.CertificateRequest.EmailAddresses = append(ret.CertificateRequest.EmailAddresses, name.Email)
+		}
+	}
+	for _, extension := range certificateRequest.Extensions {
+		ret.CertificateRequest.Extensions = append(ret.CertificateRequest.Extensions, Extension{
+			ID:       extension.Id.String(),
+			Critical: extension.Critical,
+		})
+	}
+
+	return &ret, ""
+}
+
+// subjectAltNameTypes are the values of SubjectAltName.Type.
+var subjectAltNameTypes = map[san.Type]string{
+	san.OtherName:     "otherName",
+	san.Email:         "email",
+	san.DNS:           "dns",
+	san.X400Address:   "x400Address",
+	san.DirectoryName: "directoryName",
+	san.EDIPartyName:  "ediPartyName",
+	san.URI:           "uri",
+	san.IP:            "ip",
+	san.RegisteredID:  "registeredID",
+}
+
+func subjectAltName(name san.Name) SubjectAltName {
+	ret := SubjectAltName{
+		Type: subjectAltNameTypes[name.Type],
+		Raw:  name.Raw,
+	}
+	switch name.Type {
+	case san.DNS, san.IP, san.URI:
+		ret.Value = name.String()
+	case san.Email:
+		ret.Value = name.Email
+	case san.OtherName:
+		ret.Value = name.UPN
+		ret.OID = name.OID.String()
+	case san.RegisteredID:
+		ret.OID = name.OID.String()
+	case san.DirectoryName:
+		var directoryName pkix.Name
+		directoryName.FillFromRDNSequence(&name.DirectoryName)
+		ret.Value = directoryName.String()
+	}
+	return ret
+}
+
+func publicKeyBits(publicKey interface{}) int {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return ed25519.PublicKeySize * 8
+	}
+	return 0
+}
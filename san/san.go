@@ -0,0 +1,218 @@
+package san
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"unicode/utf8"
+)
+
+// Type is the GeneralName tag of a Subject Alt Name.
+type Type int
+
+const (
+	OtherName     Type = 0
+	Email         Type = 1
+	DNS           Type = 2
+	X400Address   Type = 3
+	DirectoryName Type = 4
+	EDIPartyName  Type = 5
+	URI           Type = 6
+	IP            Type = 7
+	RegisteredID  Type = 8
+)
+
+var typeNames = []string{
+	"otherName",
+	"email address",
+	"DNS name",
+	"x400Address",
+	"directoryName",
+	"ediPartyName",
+	"URI",
+	"IP address",
+	"registeredID",
+}
+
+func (t Type) String() string {
+	if t < 0 || int(t) >= len(typeNames) {
+		return fmt.Sprintf("type %d", int(t))
+	}
+	return typeNames[t]
+}
+
+// Name is a single Subject Alt Name. Which of the fields other than Type and Raw are set
+// depends on the Type.
+type Name struct {
+	Type Type
+	// DNSName, Email and URI are set for names of type DNS, Email and URI.
+	DNSName string
+	Email   string
+	URI     string
+	// IP is set for names of type IP.
+	IP net.IP
+	// OID is the type-id of an OtherName or the identifier of a RegisteredID.
+	OID asn1.ObjectIdentifier
+	// UPN is set for an OtherName that is a Microsoft User Principal Name.
+	UPN string
+	// DirectoryName is set for names of type DirectoryName.
+	DirectoryName pkix.RDNSequence
+	// Raw is the complete encoded GeneralName.
+	Raw []byte
+}
+
+var (
+	oidExtensionSubjectAltName = []int{2, 5, 29, 17}
+	// OidUPN is the type-id of a Microsoft User Principal Name OtherName.
+	OidUPN = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// String returns the name in the form used in messages.
+func (n Name) String() string {
+	switch n.Type {
+	case DNS:
+		return n.DNSName
+	case IP:
+		return n.IP.String()
+	case URI:
+		return n.URI
+	default:
+		return fmt.Sprintf("Name of type %v", int(n.Type))
+	}
+}
+
+// Parse returns the Subject Alt Names in the CSR's SubjectAltName extension. It returns a message
+// to take adverse action if there is more than one SubjectAltName extension or if the extension or
+// any name in it is malformed or empty.
+func Parse(certificateRequest *x509.CertificateRequest) (names []Name, rejectMessage string) {
+	found := false
+	for _, extension := range certificateRequest.Extensions {
+		if !extension.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		if found {
+			return nil, "Request has more than one SubjectAltName extension"
+		}
+		found = true
+
+		var seq asn1.RawValue
+		rest, err := asn1.Unmarshal(extension.Value, &seq)
+		if err != nil {
+			return nil, fmt.Sprintf("Could not parse SubjectAltName: %v", err)
+		} else if len(rest) != 0 {
+			return nil, "Trailing data after X.509 SubjectAltName extension"
+		}
+		if !seq.IsCompound || seq.Tag != asn1.TagSequence || seq.Class != asn1.ClassUniversal {
+			return nil, "Bad SubjectAltName sequence"
+		}
+		if len(seq.Bytes) == 0 {
+			return nil, "SubjectAltName extension has no names"
+		}
+
+		rest = seq.Bytes
+		for len(rest) > 0 {
+			var v asn1.RawValue
+			rest, err = asn1.Unmarshal(rest, &v)
+			if err != nil {
+				return nil, fmt.Sprintf("Could not parse SubjectAltName: %v", err)
+			}
+			name, problem := parseName(v)
+			if problem != "" {
+				return nil, fmt.Sprintf("Malformed Subject Alt Name %d: %s", len(names)+1, problem)
+			}
+			names = append(names, name)
+		}
+	}
+
+	return names, ""
+}
+
+// parseName decodes a single GeneralName, returning a description of the problem if it is malformed.
+func parseName(v asn1.RawValue) (Name, string) {
+	name := Name{Type: Type(v.Tag), Raw: v.FullBytes}
+	if v.Class != asn1.ClassContextSpecific {
+		return name, "not a context-specific GeneralName"
+	}
+	if name.Type > RegisteredID {
+		return name, fmt.Sprintf("unknown GeneralName tag %d", v.Tag)
+	}
+
+	constructed := name.Type == OtherName || name.Type == X400Address || name.Type == DirectoryName || name.Type == EDIPartyName
+	if v.IsCompound != constructed {
+		if constructed {
+			return name, fmt.Sprintf("%s is not constructed", name.Type)
+		}
+		return name, fmt.Sprintf("%s is not primitive", name.Type)
+	}
+
+	switch name.Type {
+	case OtherName:
+		var value, wrapper asn1.RawValue
+		rest, err := asn1.Unmarshal(v.Bytes, &name.OID)
+		if err == nil {
+			rest, err = asn1.Unmarshal(rest, &wrapper)
+		}
+		if err != nil || len(rest) != 0 || wrapper.Class != asn1.ClassContextSpecific || wrapper.Tag != 0 || !wrapper.IsCompound {
+			return name, "invalid otherName"
+		}
+		if rest, err = asn1.Unmarshal(wrapper.Bytes, &value); err != nil || len(rest) != 0 {
+			return name, "invalid otherName"
+		}
+		if name.OID.Equal(OidUPN) {
+			if value.Class != asn1.ClassUniversal || value.Tag != asn1.TagUTF8String || !utf8.Valid(value.Bytes) {
+				return name, "UPN is not a UTF8String"
+			}
+			name.UPN = string(value.Bytes)
+			if name.UPN == "" {
+				return name, "empty UPN"
+			}
+		}
+	case Email, DNS, URI:
+		value, problem := ia5String(name.Type, v.Bytes)
+		if problem != "" {
+			return name, problem
+		}
+		switch name.Type {
+		case Email:
+			name.Email = value
+		case DNS:
+			name.DNSName = value
+		case URI:
+			name.URI = value
+		}
+	case DirectoryName:
+		var rdnSequence pkix.RDNSequence
+		if rest, err := asn1.Unmarshal(v.Bytes, &rdnSequence); err != nil || len(rest) != 0 {
+			return name, "invalid directoryName"
+		}
+		if len(rdnSequence) == 0 {
+			return name, "empty directoryName"
+		}
+		name.DirectoryName = rdnSequence
+	case IP:
+		if len(v.Bytes) != net.IPv4len && len(v.Bytes) != net.IPv6len {
+			return name, fmt.Sprintf("IP address has length %d", len(v.Bytes))
+		}
+		name.IP = net.IP(v.Bytes)
+	case RegisteredID:
+		if _, err := asn1.UnmarshalWithParams(v.FullBytes, &name.OID, "tag:8"); err != nil {
+			return name, "invalid registeredID"
+		}
+	}
+
+	return name, ""
+}
+
+func ia5String(t Type, value []byte) (string, string) {
+	if len(value) == 0 {
+		return "", fmt.Sprintf("empty %s", t)
+	}
+	for _, b := range value {
+		if b >= utf8.RuneSelf {
+			return "", fmt.Sprintf("%s is not an IA5String", t)
+		}
+	}
+	return string(value), ""
+}
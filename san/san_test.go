@@ -0,0 +1,241 @@
+package san_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"github.com/proofpoint/kapprover/san"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	certificateRequest := makeCertificateRequest(t, x509.CertificateRequest{
+		DNSNames:       []string{"example.invalid"},
+		IPAddresses:    []net.IP{net.ParseIP("10.1.2.3")},
+		EmailAddresses: []string{"nobody@example.invalid"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "cluster.local", Path: "/ns/somenamespace/sa/someaccount"}},
+	})
+
+	names, msg := san.Parse(certificateRequest)
+	assert.Empty(t, msg, "Message")
+	require.Len(t, names, 4, "Names")
+	assert.Equal(t, san.DNS, names[0].Type, "DNS type")
+	assert.Equal(t, "example.invalid", names[0].DNSName, "DNS name")
+	assert.Equal(t, "example.invalid", names[0].String(), "DNS string")
+	assert.Equal(t, san.Email, names[1].Type, "Email type")
+	assert.Equal(t, "Name of type 1", names[1].String(), "Email string")
+	assert.Equal(t, san.IP, names[2].Type, "IP type")
+	assert.True(t, net.ParseIP("10.1.2.3").Equal(names[2].IP), "IP")
+	assert.Equal(t, "10.1.2.3", names[2].String(), "IP string")
+	assert.Equal(t, san.URI, names[3].Type, "URI type")
+	assert.Equal(t, "spiffe://cluster.local/ns/somenamespace/sa/someaccount", names[3].URI, "URI")
+	assert.Equal(t, "spiffe://cluster.local/ns/somenamespace/sa/someaccount", names[3].String(), "URI string")
+}
+
+func TestParseNoNames(t *testing.T) {
+	names, msg := san.Parse(makeCertificateRequest(t, x509.CertificateRequest{}))
+	assert.Empty(t, msg, "Message")
+	assert.Empty(t, names, "Names")
+}
+
+func TestParseTrailingData(t *testing.T) {
+	certificateRequest := makeCertificateRequest(t, x509.CertificateRequest{
+		ExtraExtensions: []pkix.Extension{{Id: []int{2, 5, 29, 17}, Value: []byte{0x30, 0x00, 0x00}}},
+	})
+
+	names, msg := san.Parse(certificateRequest)
+	assert.Equal(t, "Trailing data after X.509 SubjectAltName extension", msg, "Message")
+	assert.Nil(t, names, "Names")
+}
+
+func TestParseTypes(t *testing.T) {
+	upn := otherName(t, san.OidUPN, asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte("user@example.invalid")})
+	other := otherName(t, asn1.ObjectIdentifier{1, 2, 3, 4}, asn1.RawValue{Tag: asn1.TagOctetString, Bytes: []byte{1, 2}})
+	registeredID, err := asn1.MarshalWithParams(asn1.ObjectIdentifier{1, 2, 3, 5}, "tag:8")
+	require.NoError(t, err, "Marshal registeredID")
+	rdnSequence := pkix.RDNSequence{{{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "example.invalid"}}}
+	directoryName, err := asn1.MarshalWithParams(rdnSequence, "explicit,tag:4")
+	require.NoError(t, err, "Marshal directoryName")
+
+	names, msg := san.Parse(&x509.CertificateRequest{Extensions: []pkix.Extension{
+		sanExtension(t, upn, other, registeredID, directoryName,
+			generalName(t, san.Email, "nobody@example.invalid"),
+			generalName(t, san.IP, string(net.ParseIP("fe80::1")))),
+	}})
+	assert.Empty(t, msg, "Message")
+	require.Len(t, names, 6, "Names")
+
+	assert.Equal(t, san.OtherName, names[0].Type, "UPN type")
+	assert.Equal(t, san.OidUPN, names[0].OID, "UPN OID")
+	assert.Equal(t, "user@example.invalid", names[0].UPN, "UPN")
+	assert.Equal(t, upn, names[0].Raw, "UPN raw")
+
+	assert.Equal(t, san.OtherName, names[1].Type, "otherName type")
+	assert.Equal(t, asn1.ObjectIdentifier{1, 2, 3, 4}, names[1].OID, "otherName OID")
+	assert.Empty(t, names[1].UPN, "otherName UPN")
+
+	assert.Equal(t, san.RegisteredID, names[2].Type, "registeredID type")
+	assert.Equal(t, asn1.ObjectIdentifier{1, 2, 3, 5}, names[2].OID, "registeredID")
+
+	assert.Equal(t, san.DirectoryName, names[3].Type, "directoryName type")
+	assert.Equal(t, rdnSequence.String(), names[3].DirectoryName.String(), "directoryName")
+
+	assert.Equal(t, san.Email, names[4].Type, "Email type")
+	assert.Equal(t, "nobody@example.invalid", names[4].Email, "Email")
+
+	assert.Equal(t, san.IP, names[5].Type, "IP type")
+	assert.Equal(t, "fe80::1", names[5].String(), "IP")
+}
+
+func TestParseMalformed(t *testing.T) {
+	badUpn := otherName(t, san.OidUPN, asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte("user@example.invalid")})
+	emptyUpn := otherName(t, san.OidUPN, asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte{}})
+	emptyDirectoryName, err := asn1.MarshalWithParams(pkix.RDNSequence{}, "explicit,tag:4")
+	require.NoError(t, err, "Marshal directoryName")
+	good := generalName(t, san.DNS, "example.invalid")
+
+	for _, testcase := range []struct {
+		name          string
+		extensions    []pkix.Extension
+		expectMessage string
+	}{
+		{
+			name:          "DuplicateExtension",
+			extensions:    []pkix.Extension{sanExtension(t, good), sanExtension(t, good)},
+			expectMessage: "Request has more than one SubjectAltName extension",
+		},
+		{
+			name:          "NoNames",
+			extensions:    []pkix.Extension{sanExtension(t)},
+			expectMessage: "SubjectAltName extension has no names",
+		},
+		{
+			name:          "NotASequence",
+			extensions:    []pkix.Extension{{Id: []int{2, 5, 29, 17}, Value: []byte{0x31, 0x00}}},
+			expectMessage: "Bad SubjectAltName sequence",
+		},
+		{
+			name:          "Truncated",
+			extensions:    []pkix.Extension{{Id: []int{2, 5, 29, 17}, Value: []byte{0x30, 0x02, 0x82, 0x05}}},
+			expectMessage: "Could not parse SubjectAltName: asn1: syntax error: data truncated",
+		},
+		{
+			name:          "UniversalClass",
+			extensions:    []pkix.Extension{sanExtension(t, good, []byte{0x02, 0x01, 0x01})},
+			expectMessage: "Malformed Subject Alt Name 2: not a context-specific GeneralName",
+		},
+		{
+			name:          "UnknownTag",
+			extensions:    []pkix.Extension{sanExtension(t, []byte{0x89, 0x01, 0x01})},
+			expectMessage: "Malformed Subject Alt Name 1: unknown GeneralName tag 9",
+		},
+		{
+			name:          "ConstructedDNS",
+			extensions:    []pkix.Extension{sanExtension(t, []byte{0xa2, 0x03, 0x16, 0x01, 'a'})},
+			expectMessage: "Malformed Subject Alt Name 1: DNS name is not primitive",
+		},
+		{
+			name:          "PrimitiveOtherName",
+			extensions:    []pkix.Extension{sanExtension(t, []byte{0x80, 0x01, 0x01})},
+			expectMessage: "Malformed Subject Alt Name 1: otherName is not constructed",
+		},
+		{
+			name:          "EmptyDNS",
+			extensions:    []pkix.Extension{sanExtension(t, good, generalName(t, san.DNS, ""))},
+			expectMessage: "Malformed Subject Alt Name 2: empty DNS name",
+		},
+		{
+			name:          "EmptyEmail",
+			extensions:    []pkix.Extension{sanExtension(t, generalName(t, san.Email, ""))},
+			expectMessage: "Malformed Subject Alt Name 1: empty email address",
+		},
+		{
+			name:          "NonIA5URI",
+			extensions:    []pkix.Extension{sanExtension(t, generalName(t, san.URI, "https://caf\u00e9.example/"))},
+			expectMessage: "Malformed Subject Alt Name 1: URI is not an IA5String",
+		},
+		{
+			name:          "IPLength",
+			extensions:    []pkix.Extension{sanExtension(t, generalName(t, san.IP, "\x0a\x01\x02\x03\x04"))},
+			expectMessage: "Malformed Subject Alt Name 1: IP address has length 5",
+		},
+		{
+			name:          "InvalidOtherName",
+			extensions:    []pkix.Extension{sanExtension(t, []byte{0xa0, 0x03, 0x02, 0x01, 0x01})},
+			expectMessage: "Malformed Subject Alt Name 1: invalid otherName",
+		},
+		{
+			name:          "UPNNotUTF8String",
+			extensions:    []pkix.Extension{sanExtension(t, badUpn)},
+			expectMessage: "Malformed Subject Alt Name 1: UPN is not a UTF8String",
+		},
+		{
+			name:          "EmptyUPN",
+			extensions:    []pkix.Extension{sanExtension(t, emptyUpn)},
+			expectMessage: "Malformed Subject Alt Name 1: empty UPN",
+		},
+		{
+			name:          "InvalidRegisteredID",
+			extensions:    []pkix.Extension{sanExtension(t, []byte{0x88, 0x00})},
+			expectMessage: "Malformed Subject Alt Name 1: invalid registeredID",
+		},
+		{
+			name:          "EmptyDirectoryName",
+			extensions:    []pkix.Extension{sanExtension(t, emptyDirectoryName)},
+			expectMessage: "Malformed Subject Alt Name 1: empty directoryName",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			names, msg := san.Parse(&x509.CertificateRequest{Extensions: testcase.extensions})
+			assert.Equal(t, testcase.expectMessage, msg, "Message")
+			assert.Nil(t, names, "Names")
+		})
+	}
+}
+
+func sanExtension(t *testing.T, names ...[]byte) pkix.Extension {
+	var content []byte
+	for _, name := range names {
+		content = append(content, name...)
+	}
+	value, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: content})
+	require.NoError(t, err, "Marshal the extension")
+	return pkix.Extension{Id: []int{2, 5, 29, 17}, Value: value}
+}
+
+func generalName(t *testing.T, nameType san.Type, value string) []byte {
+	encoded, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: int(nameType), Bytes: []byte(value)})
+	require.NoError(t, err, "Marshal the name")
+	return encoded
+}
+
+func otherName(t *testing.T, typeID asn1.ObjectIdentifier, value asn1.RawValue) []byte {
+	encodedTypeID, err := asn1.Marshal(typeID)
+	require.NoError(t, err, "Marshal the type-id")
+	encodedValue, err := asn1.Marshal(value)
+	require.NoError(t, err, "Marshal the value")
+	wrappedValue, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encodedValue})
+	require.NoError(t, err, "Marshal the wrapped value")
+	encoded, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(encodedTypeID, wrappedValue...)})
+	require.NoError(t, err, "Marshal the otherName")
+	return encoded
+}
+
+func makeCertificateRequest(t *testing.T, template x509.CertificateRequest) *x509.CertificateRequest {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Generate the private key")
+
+	template.Subject = pkix.Name{CommonName: "example.invalid"}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	require.NoError(t, err, "Generate the CSR")
+
+	certificateRequest, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err, "Parse the CSR")
+	return certificateRequest
+}
@@ -0,0 +1,70 @@
+package spiffe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	scheme    = "spiffe://"
+	maxLength = 2048
+)
+
+// Parse validates a SPIFFE ID of the form spiffe://<trust-domain>/<path> and returns its
+// trust domain and path. The path is either empty or starts with "/".
+func Parse(id string) (trustDomain, path string, err error) {
+	if len(id) > maxLength {
+		return "", "", fmt.Errorf("longer than %d bytes", maxLength)
+	}
+	if !strings.HasPrefix(id, scheme) {
+		return "", "", errors.New("scheme is not spiffe")
+	}
+
+	rest := id[len(scheme):]
+	trustDomain = rest
+	if i := strings.Index(rest, "/"); i != -1 {
+		trustDomain, path = rest[:i], rest[i:]
+	}
+
+	if err = ValidateTrustDomain(trustDomain); err != nil {
+		return "", "", err
+	}
+	if err = validatePath(path); err != nil {
+		return "", "", err
+	}
+	return trustDomain, path, nil
+}
+
+// ValidateTrustDomain returns an error if trustDomain is not a valid SPIFFE trust domain name.
+func ValidateTrustDomain(trustDomain string) error {
+	if trustDomain == "" {
+		return errors.New("trust domain is empty")
+	}
+	for _, c := range trustDomain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return fmt.Errorf("trust domain has invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+func validatePath(path string) error {
+	if path == "" {
+		return nil
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		switch segment {
+		case "":
+			return errors.New("path has an empty segment")
+		case ".", "..":
+			return fmt.Errorf("path has a %q segment", segment)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return fmt.Errorf("path has invalid character %q", c)
+			}
+		}
+	}
+	return nil
+}
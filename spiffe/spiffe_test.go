@@ -0,0 +1,46 @@
+package spiffe_test
+
+import (
+	"github.com/proofpoint/kapprover/spiffe"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, testcase := range []struct {
+		id                string
+		expectTrustDomain string
+		expectPath        string
+		expectErr         string
+	}{
+		{id: "spiffe://cluster.local/ns/somenamespace/sa/someaccount", expectTrustDomain: "cluster.local", expectPath: "/ns/somenamespace/sa/someaccount"},
+		{id: "spiffe://example-1_2.org", expectTrustDomain: "example-1_2.org"},
+		{id: "spiffe://example.org/Mixed.Case-path_1", expectTrustDomain: "example.org", expectPath: "/Mixed.Case-path_1"},
+		{id: "https://example.org/path", expectErr: "scheme is not spiffe"},
+		{id: "SPIFFE://example.org/path", expectErr: "scheme is not spiffe"},
+		{id: "spiffe:///path", expectErr: "trust domain is empty"},
+		{id: "spiffe://Example.org/path", expectErr: "trust domain has invalid character 'E'"},
+		{id: "spiffe://example.org:8080/path", expectErr: "trust domain has invalid character ':'"},
+		{id: "spiffe://user@example.org/path", expectErr: "trust domain has invalid character '@'"},
+		{id: "spiffe://example.org/", expectErr: "path has an empty segment"},
+		{id: "spiffe://example.org/a//b", expectErr: "path has an empty segment"},
+		{id: "spiffe://example.org/a/../b", expectErr: "path has a \"..\" segment"},
+		{id: "spiffe://example.org/./b", expectErr: "path has a \".\" segment"},
+		{id: "spiffe://example.org/path?query", expectErr: "path has invalid character '?'"},
+		{id: "spiffe://example.org/path#fragment", expectErr: "path has invalid character '#'"},
+		{id: "spiffe://example.org/pa%20th", expectErr: "path has invalid character '%'"},
+		{id: "spiffe://example.org/" + strings.Repeat("a", 2048), expectErr: "longer than 2048 bytes"},
+	} {
+		t.Run(testcase.id, func(t *testing.T) {
+			trustDomain, path, err := spiffe.Parse(testcase.id)
+			if testcase.expectErr != "" {
+				assert.EqualError(t, err, testcase.expectErr, "Error")
+				return
+			}
+			assert.NoError(t, err, "Error")
+			assert.Equal(t, testcase.expectTrustDomain, trustDomain, "Trust domain")
+			assert.Equal(t, testcase.expectPath, path, "Path")
+		})
+	}
+}